@@ -0,0 +1,312 @@
+package main
+
+import (
+	"MuSL/MuSL"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// 実験の引数 (replicate と sweep で共通)
+type experiment_flags struct {
+	replicates int
+	output_dir string
+	jobs       int
+	fields     string
+}
+
+func addExperimentFlags(fs *flag.FlagSet, replicates int, output_dir string) *experiment_flags {
+	e := &experiment_flags{}
+	fs.IntVar(&e.replicates, "replicates", replicates, "Number of seeds per configuration, counting up from -seed (default: "+strconv.Itoa(replicates)+")")
+	fs.StringVar(&e.output_dir, "output_dir", output_dir, "Output directory of the summeries and their aggregates (default: "+output_dir+")")
+	fs.IntVar(&e.jobs, "jobs", 1, "Number of simulations run at the same time (default: 1)")
+	fs.StringVar(&e.fields, "fields", "", "Comma-separated summery values to aggregate, empty for all numeric values (default: \"\")")
+	return e
+}
+
+func (e *experiment_flags) check() error {
+	if e.replicates < 1 {
+		return &CommandError{"Invalid replicates", errors.New("must be at least 1")}
+	}
+	if e.jobs < 1 {
+		return &CommandError{"Invalid jobs", errors.New("must be at least 1")}
+	}
+	// 集計する項目の名前を先に確かめる
+	if _, err := MuSL.AggregateSummeries(nil, splitList(e.fields)); err != nil {
+		return &CommandError{"Invalid fields", err}
+	}
+	return nil
+}
+
+// 実験の 1 回の実行
+type experiment_run struct {
+	config  *MuSL.SimulationConfig
+	file    string
+	summery []*MuSL.PublicSummery // 集計用 (ジャンルを除く)
+}
+
+// 同じ設定でシードだけを変えて、いくつかのシミュレーションを実行し集計する
+func replicateCommand(fs *flag.FlagSet, args []string) error {
+	config_args := addConfigFlags(fs)
+	experiment := addExperimentFlags(fs, 10, "replicates")
+	config, err := parseConfig(fs, config_args, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+	if err := experiment.check(); err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return &CommandError{"Invalid parameters", err}
+	}
+	chooseSeed(config, experiment.replicates)
+	fmt.Println("Seed:", config.Seed)
+
+	if err := os.MkdirAll(experiment.output_dir, 0755); err != nil {
+		return &CommandError{"Error creating output directory", err}
+	}
+	if err := writeJSON(filepath.Join(experiment.output_dir, "config.json"), config); err != nil {
+		return &CommandError{"Error writing config", err}
+	}
+
+	runs := makeReplicates(config, experiment.replicates, experiment.output_dir)
+	if err := runExperiments(runs, experiment.jobs); err != nil {
+		return err
+	}
+
+	aggregate, err := writeAggregate(runs, splitList(experiment.fields), experiment.output_dir)
+	if err != nil {
+		return err
+	}
+	printFinal(aggregate)
+	return nil
+}
+
+// パラメータの値ごとに、シードを変えていくつかのシミュレーションを実行し集計する
+// 値ごとの集計は <output_dir>/<param>_<value>/summary.csv に、最後のイテレーションの比較は <output_dir>/sweep.csv に書き出す。
+func sweepCommand(fs *flag.FlagSet, args []string) error {
+	var param string
+	var values string
+	fs.StringVar(&param, "param", "", "Name of the swept parameter, as in the config JSON (required)")
+	fs.StringVar(&values, "values", "", "Comma-separated values of the parameter (required)")
+	config_args := addConfigFlags(fs)
+	experiment := addExperimentFlags(fs, 1, "sweep")
+	config, err := parseConfig(fs, config_args, args)
+	if err != nil {
+		return err
+	}
+	value_list := splitList(values)
+	if fs.NArg() > 0 || param == "" || len(value_list) == 0 {
+		return errUsage
+	}
+	if err := experiment.check(); err != nil {
+		return err
+	}
+	chooseSeed(config, experiment.replicates)
+
+	// すべての値の設定を確かめてから実行する (スイープするのが seed なら、その値から数え上げる)
+	configs := make([]*MuSL.SimulationConfig, len(value_list))
+	for i, value := range value_list {
+		configs[i] = copyConfig(config)
+		if err := configs[i].Set(param, value); err != nil {
+			return &CommandError{"Invalid sweep", err}
+		}
+		if err := configs[i].Validate(); err != nil {
+			return &CommandError{"Invalid parameters for " + param + "=" + value, err}
+		}
+	}
+	fmt.Println("Seed:", config.Seed)
+
+	if err := os.MkdirAll(experiment.output_dir, 0755); err != nil {
+		return &CommandError{"Error creating output directory", err}
+	}
+	if err := writeJSON(filepath.Join(experiment.output_dir, "config.json"), config); err != nil {
+		return &CommandError{"Error writing config", err}
+	}
+
+	groups := make([][]*experiment_run, len(value_list))
+	runs := make([]*experiment_run, 0)
+	for i, value := range value_list {
+		dir := filepath.Join(experiment.output_dir, param+"_"+value)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &CommandError{"Error creating output directory", err}
+		}
+		groups[i] = makeReplicates(configs[i], experiment.replicates, dir)
+		runs = append(runs, groups[i]...)
+	}
+	if err := runExperiments(runs, experiment.jobs); err != nil {
+		return err
+	}
+
+	aggregates := make([]*MuSL.Aggregate, len(groups))
+	for i, group := range groups {
+		if aggregates[i], err = writeAggregate(group, splitList(experiment.fields), filepath.Dir(group[0].file)); err != nil {
+			return err
+		}
+	}
+
+	sweep_file := filepath.Join(experiment.output_dir, "sweep.csv")
+	if err := writeFile(sweep_file, func(file *os.File) error {
+		return MuSL.WriteSweepCSV(file, param, value_list, aggregates)
+	}); err != nil {
+		return &CommandError{"Error writing sweep", err}
+	}
+	fmt.Println("Wrote", sweep_file)
+	return nil
+}
+
+// サマリーのファイルを読み、実行をまたいでイテレーションごとに集計する
+func analyzeCommand(fs *flag.FlagSet, args []string) error {
+	var output_file string
+	var fields string
+	fs.StringVar(&output_file, "output_file", "analysis.csv", "Output CSV of the per-iteration aggregates, empty to skip (default: analysis.csv)")
+	fs.StringVar(&fields, "fields", "", "Comma-separated summery values to aggregate, empty for all numeric values (default: \"\")")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	runs := make([][]*MuSL.PublicSummery, fs.NArg())
+	for i, file_name := range fs.Args() {
+		var err error
+		if runs[i], err = readSummeryFile(file_name); err != nil {
+			return &CommandError{"Error reading " + file_name, err}
+		}
+	}
+
+	aggregate, err := MuSL.AggregateSummeries(runs, splitList(fields))
+	if err != nil {
+		return &CommandError{"Invalid fields", err}
+	}
+	if output_file != "" {
+		if err := writeFile(output_file, func(file *os.File) error {
+			return aggregate.WriteCSV(file)
+		}); err != nil {
+			return &CommandError{"Error writing analysis", err}
+		}
+	}
+	printFinal(aggregate)
+	return nil
+}
+
+// シードが負なら、n 個のシードを数え上げても溢れないようにランダムに決める
+func chooseSeed(config *MuSL.SimulationConfig, n int) {
+	if config.Seed < 0 {
+		config.Seed = rand.Int64N(math.MaxInt64 - int64(n))
+	}
+}
+
+func copyConfig(config *MuSL.SimulationConfig) *MuSL.SimulationConfig {
+	c := *config
+	c.GenreAt = append([]int{}, config.GenreAt...)
+	return &c
+}
+
+// config のシードから 1 ずつ増やしたシードで n 回分の実行を作る
+// 値を変えても同じシードの列を使うので、スイープの比較でシードの違いが混ざらない。
+func makeReplicates(config *MuSL.SimulationConfig, n int, dir string) []*experiment_run {
+	runs := make([]*experiment_run, n)
+	for i := range n {
+		c := copyConfig(config)
+		c.Seed = config.Seed + int64(i)
+		runs[i] = &experiment_run{
+			config: c,
+			file:   filepath.Join(dir, "seed_"+strconv.FormatInt(c.Seed, 10)+".json"),
+		}
+	}
+	return runs
+}
+
+// jobs 個ずつ同時に実行し、それぞれのサマリーを書き出す
+// ID はプロセス全体で通し番号だが、結果には影響しないので、同時に実行しても単独で実行した場合と同じサマリーになる。
+func runExperiments(runs []*experiment_run, jobs int) error {
+	errs := make([]error, len(runs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(runs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = runExperiment(runs[i])
+			}
+		}()
+	}
+	for i := range runs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func runExperiment(run *experiment_run) error {
+	sim, err := run.config.Build()
+	if err != nil {
+		return &CommandError{"Invalid parameters", err}
+	}
+	sim.SetVerbose(false)
+	if err := sim.Run(); err != nil {
+		return &CommandError{"Error running " + run.file, err}
+	}
+
+	summery := sim.GetSummery()
+	if err := writeJSON(run.file, summery); err != nil {
+		return &CommandError{"Error writing summery", err}
+	}
+	fmt.Println("Wrote", run.file)
+
+	// 集計にはジャンルを使わないので、メモリを空ける
+	for _, s := range summery {
+		s.AllGenres = nil
+		s.GenresCompact = ""
+	}
+	run.summery = summery
+	return nil
+}
+
+// 実行のサマリーを集計し、dir/summary.csv に書き出す
+func writeAggregate(runs []*experiment_run, fields []string, dir string) (*MuSL.Aggregate, error) {
+	summeries := make([][]*MuSL.PublicSummery, len(runs))
+	for i, run := range runs {
+		summeries[i] = run.summery
+	}
+	aggregate, err := MuSL.AggregateSummeries(summeries, fields)
+	if err != nil {
+		return nil, &CommandError{"Invalid fields", err}
+	}
+
+	file_name := filepath.Join(dir, "summary.csv")
+	if err := writeFile(file_name, func(file *os.File) error {
+		return aggregate.WriteCSV(file)
+	}); err != nil {
+		return nil, &CommandError{"Error writing aggregate", err}
+	}
+	fmt.Println("Wrote", file_name)
+	return aggregate, nil
+}
+
+// 最後のイテレーションの統計量を表示する
+func printFinal(aggregate *MuSL.Aggregate) {
+	final := aggregate.Final()
+	if final == nil {
+		return
+	}
+	k := len(aggregate.Iterations) - 1
+	fmt.Printf("iteration %d (%d runs)\n", aggregate.Iterations[k], aggregate.Runs[k])
+	fmt.Printf("%-26s %14s %14s %14s %14s\n", "", "mean", "sd", "min", "max")
+	for i, name := range aggregate.Fields {
+		s := final[i]
+		fmt.Printf("%-26s %14.6g %14.6g %14.6g %14.6g\n", name, s.Mean, s.SD, s.Min, s.Max)
+	}
+}
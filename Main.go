@@ -3,100 +3,274 @@ package main
 import (
 	"MuSL/MuSL"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-func main() {
-	// コマンドライン引数でメジャーイベントの確率および出力先を指定
-	var major_probability float64
-	var output_file string
+// サブコマンド
+type command struct {
+	name    string
+	usage   string // 引数の書き方
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []*command{
+	{"run", "[flags]", "Run a simulation and write its outputs", runCommand},
+	{"resume", "[flags] <checkpoint>", "Resume a simulation from a checkpoint and write its outputs", resumeCommand},
+	{"replicate", "[flags]", "Run a configuration with several seeds and aggregate the summeries", replicateCommand},
+	{"sweep", "-param <name> -values <v1,v2,...> [flags]", "Replicate a configuration for each value of a parameter", sweepCommand},
+	{"analyze", "[flags] <summery file>...", "Aggregate summery files of several runs per iteration", analyzeCommand},
+	{"plot", "[flags] <summery file>", "Write SVG charts of a summery file", plotCommand},
+	{"animate", "[flags] <phylogeny file>", "Write an animated GIF of the genre space from a phylogeny file", animateCommand},
+	{"expand-genres", "[flags] <summery file>", "Expand compact genre snapshots of a summery file", expandGenresCommand},
+	{"validate-config", "[flags]", "Check a configuration and print it as JSON", validateConfigCommand},
+	{"api", "[flags]", "Serve the HTTP API to create, step and inspect simulations", apiCommand},
+}
+
+// 引数の誤り (main が使い方を表示する)
+var errUsage = errors.New("usage")
+
+// サブコマンドの失敗
+type CommandError struct {
+	Message string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return e.Message + ": " + e.Err.Error()
+}
 
-	flag.Float64Var(&major_probability, "major_probability", 0.5, "Probability of major events (default: 0.5)")
-	flag.StringVar(&output_file, "output_file", "output.json", "Output file name (default: output.json)")
-	flag.Parse()
+func main() {
+	// サブコマンドを省略した場合は run (以前の使い方との互換のため)
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	if major_probability < 0 || major_probability > 1 {
-		fmt.Println("Invalid major_probability: must be between 0 and 1")
+	if name == "help" {
+		if len(args) > 0 {
+			if c := findCommand(args[0]); c != nil {
+				// 引数はサブコマンドの中で登録するので、-h を渡して使い方を表示させる
+				c.run(newFlagSet(c), []string{"-h"})
+				return
+			}
+		}
+		printUsage()
 		return
 	}
 
-	// シミュレーションのパラメータ
-	n_agents := 100
-	n_iter := 100
-
-	ga_params := MuSL.MakeGAParams(
-		0.1,  // mutation_rate
-		0.05, // mutation_strength
-	)
-
-	// [*] = Experiment-specific
-	default_agent_params := MuSL.MakeNewAgent(
-		-1,                       //     id
-		[]bool{true, true, true}, //     role
-		100.0,                    //     energy
-		100.0,                    // [*] default_energy
-		0.0,                      // [*] elimination_threshold
-		0.5,                      //     reproduction_probability
-
-		// creator
-		0.5,                   //     innovation_rate
-		make([]*MuSL.Song, 0), //     memory
-		0.5,                   //     creation_probability
-		1.0,                   // [*] creation_cost
-
-		// listener
-		0.5,                    //     novelty_preference
-		make([]*MuSL.Song, 0),  //     memory
-		make([]*MuSL.Song, 0),  //     incoming_songs
-		make([]*MuSL.Event, 0), //     song_events
-		0.5,                    //     listening_probability
-		1.0,                    // [*] evaluation_cost
-
-		// organizer
-		MuSL.Const64(major_probability), // [*] major_probability
-		make([]*MuSL.Event, 0),          //     created_events
-		0.5,                             //     event_probability
-		0.5,                             // [*] organization_cost
-		1.0,                             // [*] organization_reward
-
-		// イベント生成用のパラメータ
-		// メジャーイベント
-		0.5, // [*] major_listener_ratio
-		0.5, // [*] major_creator_ratio
-		0.1, // [*] major_song_ratio
-		0.5, // [*] major_winner_ratio
-		0.5, // [*] major_reward_ratio
-		0.1, // [*] major_recommendation_ratio
-
-		// マイナーイベント
-		0.1, // [*] minor_listener_ratio
-		0.1, // [*] minor_creator_ratio
-		0.5, // [*] minor_song_ratio
-		0.5, // [*] minor_reward_ratio
-		0.1, // [*] minor_recommendation_ratio
-	)
-
-	sim := MuSL.MakeNewSimulation(n_agents, n_iter, ga_params, default_agent_params)
-	sim.Run()
-
-	summery := sim.GetSummery() // []*PublicSummery
-
-	// サマリーを json に変換
-	json, err := json.MarshalIndent(summery, "", "  ")
+	c := findCommand(name)
+	if c == nil {
+		fmt.Fprintln(os.Stderr, "Unknown command:", name)
+		printUsage()
+		os.Exit(2)
+	}
+
+	fs := newFlagSet(c)
+	if err := c.run(fs, args); err == errUsage {
+		fs.Usage()
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	program := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags] [arguments]\n\ncommands:\n", program)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nWithout a command, the flags are those of run.\nRun \"%s help <command>\" for the flags of a command.\n", program)
+}
+
+// サブコマンドの引数を読む FlagSet (-h で使い方を表示する)
+func newFlagSet(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n\n%s.\n\nflags:\n", filepath.Base(os.Args[0]), c.name, c.usage, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// シミュレーションの設定を読み込む引数 (run, replicate, sweep, validate-config で共通)
+// 引数の名前は SimulationConfig の JSON の名前と同じ。
+type config_flags struct {
+	config      *MuSL.SimulationConfig
+	config_file string
+}
+
+func addConfigFlags(fs *flag.FlagSet) *config_flags {
+	f := &config_flags{config: MuSL.DefaultSimulationConfig()}
+	c := f.config
+
+	fs.StringVar(&f.config_file, "config", "", "JSON file of the simulation config; the flags below override it (default: none)")
+	fs.IntVar(&c.NumAgents, "num_agents", c.NumAgents, "Number of agents at the start (default: 100)")
+	fs.IntVar(&c.NumIterations, "num_iterations", c.NumIterations, "Number of iterations (default: 100)")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "Random seed, negative for a random seed (default: -1)")
+	fs.Float64Var(&c.MajorProbability, "major_probability", c.MajorProbability, "Probability of major events (default: 0.5)")
+	fs.Float64Var(&c.MutationRate, "mutation_rate", c.MutationRate, "Probability that a gene mutates at reproduction (default: 0.1)")
+	fs.Float64Var(&c.MutationStrength, "mutation_strength", c.MutationStrength, "Maximum change of a gene mutation, drawn uniformly from [-mutation_strength, mutation_strength] (default: 0.05)")
+	fs.IntVar(&c.MemoryCapacity, "memory_capacity", c.MemoryCapacity, "Maximum number of songs an agent remembers, 0 for unlimited (default: 0)")
+	fs.StringVar(&c.MemoryPolicy, "memory_policy", c.MemoryPolicy, "Forgetting policy: none, fifo, random, decay or least_rated (default: none)")
+	fs.Float64Var(&c.MemoryDecayRate, "memory_decay_rate", c.MemoryDecayRate, "Decay rate of memory weights per iteration for the decay policy (default: 0.1)")
+	fs.BoolVar(&c.MemoryEvolvable, "memory_evolvable", c.MemoryEvolvable, "Scale memory capacity by the evolvable memory_retention gene (default: false)")
+	fs.StringVar(&c.Scheduler, "scheduler", c.Scheduler, "Agent activation order: fixed, random, role or synchronous (default: fixed)")
+	fs.BoolVar(&c.Parallel, "parallel", c.Parallel, "Run each phase of the synchronous scheduler in parallel; the results do not change (default: false)")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "Number of goroutines for -parallel (default: number of CPUs)")
+	fs.IntVar(&c.GenreEvery, "genre_every", c.GenreEvery, "Take a genre snapshot every this many iterations, 0 for only -genre_at (default: 1)")
+	fs.Var((*intList)(&c.GenreAt), "genre_at", "Comma-separated iterations at which a genre snapshot is always taken (default: none)")
+	fs.IntVar(&c.GenreSample, "genre_sample", c.GenreSample, "Maximum number of songs per genre snapshot, 0 for all (default: 0)")
+	fs.StringVar(&c.GenreEncoding, "genre_encoding", c.GenreEncoding, "Genre snapshot storage: raw or compact (default: raw)")
+	fs.IntVar(&c.DiversityGrid, "diversity_grid", c.DiversityGrid, "Number of cells per genre axis for the diversity metrics (default: 10)")
+	return f
+}
+
+// 引数を読み、-config のファイルの設定に、引数で指定した項目を上書きした設定を返す
+func parseConfig(fs *flag.FlagSet, f *config_flags, args []string) (*MuSL.SimulationConfig, error) {
+	fs.Parse(args)
+	if f.config_file == "" {
+		return f.config, nil
+	}
+
+	file, err := os.Open(f.config_file)
 	if err != nil {
-		fmt.Println("Error converting summery to JSON:", err)
-		return
+		return nil, &CommandError{"Error reading config", err}
+	}
+	err = MuSL.ReadSimulationConfig(file, f.config)
+	file.Close()
+	if err != nil {
+		return nil, &CommandError{"Error reading config", err}
 	}
 
-	// ファイルに書き込み
-	file, err := os.Create(output_file)
+	// 引数で指定した項目を優先する
+	fs.Parse(args)
+	return f.config, nil
+}
+
+// カンマ区切りの整数のリストを受け取る引数
+type intList []int
+
+func (l *intList) String() string {
+	if l == nil {
+		return ""
+	}
+	fields := make([]string, len(*l))
+	for i, x := range *l {
+		fields[i] = strconv.Itoa(x)
+	}
+	return strings.Join(fields, ",")
+}
+
+func (l *intList) Set(value string) error {
+	list := make([]int, 0)
+	for _, field := range splitList(value) {
+		x, err := strconv.Atoi(field)
+		if err != nil {
+			return err
+		}
+		list = append(list, x)
+	}
+	*l = list
+	return nil
+}
+
+// カンマ区切りのリスト (空の項目を除く)
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
+
+// 出力形式が指定されていなければ拡張子で決める
+func summeryFormat(file_name, format string) (string, error) {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(file_name), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return "", &CommandError{"Invalid format", errors.New("must be json or csv")}
+	}
+	return format, nil
+}
+
+// サマリーを format の形式で書き込む
+// csv の場合、スカラー値は file_name に、ジャンルは file_name の拡張子の前に _genres を付けたファイルに書き込む
+func writeSummery(file_name, format string, summery []*MuSL.PublicSummery) error {
+	if format == "json" {
+		return writeJSON(file_name, summery)
+	}
+
+	if err := writeFile(file_name, func(file *os.File) error {
+		return MuSL.WriteSummeryCSV(file, summery)
+	}); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(file_name)
+	genre_file := strings.TrimSuffix(file_name, ext) + "_genres" + ext
+	if ext == "" {
+		genre_file += ".csv"
+	}
+	return writeFile(genre_file, func(file *os.File) error {
+		return MuSL.WriteGenreCSV(file, summery)
+	})
+}
+
+// output_file または stream_file のサマリーを読み込む
+func readSummeryFile(file_name string) ([]*MuSL.PublicSummery, error) {
+	file, err := os.Open(file_name)
 	if err != nil {
-		fmt.Println("Error creating file:", err)
-		return
+		return nil, err
 	}
 	defer file.Close()
 
-	file.Write(json)
+	return MuSL.ReadSummeries(file)
+}
+
+// ファイルを作成して write で書き込む
+func writeFile(file_name string, write func(*os.File) error) error {
+	file, err := os.Create(file_name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return write(file)
+}
+
+// v を json に変換してファイルに書き込む
+func writeJSON(file_name string, v any) error {
+	json, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(file_name, func(file *os.File) error {
+		_, err := file.Write(json)
+		return err
+	})
 }
@@ -3,17 +3,17 @@ package MuSL
 import (
 	"math/rand/v2"
 	"strconv"
+	"sync/atomic"
 )
 
 type Const64 float64 // 実験時に確定する定数
 
 // エージェントの ID を管理するためのグローバル変数
-// リエントラントかどうかは気にしない
-var global_id_counter int = 0
+// 1 つのプロセスで複数のシミュレーションを同時に動かせるように、アトミックに増やす
+var global_id_counter atomic.Int64
 
 func GetNewID() int {
-	global_id_counter++
-	return global_id_counter
+	return int(global_id_counter.Add(1))
 }
 
 type Agent struct {
@@ -27,6 +27,14 @@ type Agent struct {
 	creator   *Creator
 	listener  *Listener
 	organizer *Organizer
+
+	// そのイテレーションのエネルギーの増減の内訳 (集計用、イテレーションの最初にリセットする)
+	income IncomeBreakdown
+
+	// エージェント固有の乱数生成器
+	// 並列実行でも結果が変わらないよう、エージェントの行動はすべてこれを使う
+	src *rand.PCG
+	rng *rand.Rand
 }
 
 func MakeNewAgent(
@@ -39,16 +47,18 @@ func MakeNewAgent(
 
 	// creator
 	innovation_rate float64, // ---------- Gene
-	memory_c []*Song, // ----------------- 動的に変化
+	memory_c *SongMemory, // ------------- 動的に変化 (MemoryParams は実験定数)
 	creation_probability float64, // ----- Gene
+	memory_retention_c float64, // ------- Gene
 	creation_cost Const64, // ------------ 実験定数
 
 	// listener
 	novelty_preference float64, // ------- Gene
-	memory_l []*Song, //------------------ 動的に変化
+	memory_l *SongMemory, //-------------- 動的に変化 (MemoryParams は実験定数)
 	incoming_songs []*Song, // ----------- 動的に変化
 	song_events []*Event, // ------------- 動的に変化
 	listening_probability float64, // ---- Gene
+	memory_retention_l float64, // ------- Gene
 	evaluation_cost Const64, // ---------- 実験定数
 
 	// organizer
@@ -81,8 +91,8 @@ func MakeNewAgent(
 		default_energy:           default_energy,
 		elimination_threshold:    elimination_threshold,
 		reproduction_probability: reproduction_probability,
-		creator:                  &Creator{innovation_rate, memory_c, creation_probability, creation_cost},
-		listener:                 &Listener{novelty_preference, memory_l, incoming_songs, song_events, listening_probability, evaluation_cost},
+		creator:                  &Creator{innovation_rate, memory_c, creation_probability, memory_retention_c, creation_cost},
+		listener:                 &Listener{novelty_preference, memory_l, incoming_songs, song_events, listening_probability, memory_retention_l, evaluation_cost},
 		organizer: &Organizer{major_probability, created_events, event_probability, organization_cost, organization_reward,
 			major_listener_ratio, major_creator_ratio, major_song_ratio, major_winner_ratio, major_reward_ratio, major_recommendation_ratio,
 			minor_listener_ratio, minor_creator_ratio, minor_song_ratio, minor_reward_ratio, minor_recommendation_ratio,
@@ -101,18 +111,20 @@ func MakeNewAgentFromAgent(a *Agent) *Agent {
 		-1,                          // Gene (reproduction_probability)
 
 		// creator
-		-1,                      // Gene (innovation_rate)
-		make([]*Song, 0),        // 動的に変化
-		-1,                      // Gene (creation_probability)
-		a.creator.creation_cost, // 実験定数
+		-1,                           // Gene (innovation_rate)
+		a.creator.memory.EmptyCopy(), // 動的に変化
+		-1,                           // Gene (creation_probability)
+		-1,                           // Gene (memory_retention)
+		a.creator.creation_cost,      // 実験定数
 
 		// listener
-		-1,                         // Gene (novelty_preference)
-		make([]*Song, 0),           // 動的に変化
-		make([]*Song, 0),           // 動的に変化
-		make([]*Event, 0),          // 動的に変化
-		-1,                         // Gene (listening_probability)
-		a.listener.evaluation_cost, // 実験定数
+		-1,                            // Gene (novelty_preference)
+		a.listener.memory.EmptyCopy(), // 動的に変化
+		make([]*Song, 0),              // 動的に変化
+		make([]*Event, 0),             // 動的に変化
+		-1,                            // Gene (listening_probability)
+		-1,                            // Gene (memory_retention)
+		a.listener.evaluation_cost,    // 実験定数
 
 		// organizer
 		a.organizer.major_probability,   // 実験定数
@@ -142,39 +154,42 @@ func MakeNewAgentFromAgent(a *Agent) *Agent {
 // 実験定数を受け取り、動的に変化するパラメータを初期化し、Gene をランダムで生成する
 func MakeRandomAgentFromParams(
 	id int,
-	default_params *Agent) *Agent {
+	default_params *Agent,
+	rng *rand.Rand) *Agent {
 	role := []bool{
-		rand.Float64() < 0.5,
-		rand.Float64() < 0.5,
-		rand.Float64() < 0.5,
+		rng.Float64() < 0.5,
+		rng.Float64() < 0.5,
+		rng.Float64() < 0.5,
 	}
 
-	return MakeNewAgent(
+	agent := MakeNewAgent(
 		id,
 		role,
 		float64(default_params.default_energy),
 		default_params.default_energy,
 		default_params.elimination_threshold,
-		rand.Float64(),
+		rng.Float64(),
 
 		// creator
-		rand.Float64(),
-		make([]*Song, 0),
-		rand.Float64(),
+		rng.Float64(),
+		default_params.creator.memory.EmptyCopy(),
+		rng.Float64(),
+		default_params.creator.memory.randomRetention(rng),
 		default_params.creator.creation_cost,
 
 		// listener
-		rand.Float64(),
-		make([]*Song, 0),
+		rng.Float64(),
+		default_params.listener.memory.EmptyCopy(),
 		make([]*Song, 0),
 		make([]*Event, 0),
-		rand.Float64(),
+		rng.Float64(),
+		default_params.listener.memory.randomRetention(rng),
 		default_params.listener.evaluation_cost,
 
 		// organizer
 		default_params.organizer.major_probability,
 		make([]*Event, 0),
-		rand.Float64(),
+		rng.Float64(),
 		default_params.organizer.organization_cost,
 		default_params.organizer.organization_reward,
 
@@ -194,36 +209,76 @@ func MakeRandomAgentFromParams(
 		default_params.organizer.minor_reward_ratio,
 		default_params.organizer.minor_recommendation_ratio,
 	)
+
+	// 乱数生成器も rng から初期化する
+	agent.Seed(rng.Uint64(), rng.Uint64())
+
+	return agent
 }
 
-func (a *Agent) Run(agents, new_born_pool *[]*Agent, gaParams *GAParams, default_agent_params *Agent, summery *Summery) {
+// エージェント固有の乱数生成器を初期化する
+func (a *Agent) Seed(seed1, seed2 uint64) {
+	a.src = rand.NewPCG(seed1, seed2)
+	a.rng = rand.New(a.src)
+}
 
-	// リスナー
-	if a.role[1] {
-		a.listener.Listen(agents, a, summery)
-	}
+// 1 イテレーションの行動の段階
+// 並列実行では、全エージェントが同じ段階を終えてから次の段階に進む
+const (
+	PhaseListen    = iota // 記憶の減衰と聴取
+	PhaseCreate           // 作曲
+	PhaseOrganize         // イベントの精算と開催
+	PhaseReproduce        // 再生産
+	NumPhases
+)
 
-	// クリエイター
-	if a.role[0] {
-		a.creator.Create(agents, a, summery)
+func (a *Agent) Run(agents *[]*Agent, gaParams *GAParams, default_agent_params *Agent, summery *Summery, effects *Effects) {
+	for phase := range NumPhases {
+		a.RunPhase(phase, agents, gaParams, default_agent_params, summery, effects)
 	}
+}
 
-	// オーガナイザー
-	if a.role[2] {
-		a.organizer.Organize(agents, a, summery)
-	}
+// 1 段階分の行動を行う
+// 他のエージェントや共有された Event, Song への変更は effects を通して行う
+func (a *Agent) RunPhase(phase int, agents *[]*Agent, gaParams *GAParams, default_agent_params *Agent, summery *Summery, effects *Effects) {
+	switch phase {
+	case PhaseListen:
+		// 記憶の減衰 (作成者の memory から失われた曲は消滅する)
+		for _, song := range a.creator.memory.Decay() {
+			song.extinct_iteration = summery.iteration
+		}
+		a.listener.memory.Decay()
 
-	// 再生産
-	a.Reproduce(agents, new_born_pool, gaParams, default_agent_params, summery)
+		// リスナー
+		if a.role[1] {
+			a.listener.Listen(agents, a, summery, effects)
+		}
+
+	case PhaseCreate:
+		// クリエイター
+		if a.role[0] {
+			a.creator.Create(agents, a, summery, effects)
+		}
+
+	case PhaseOrganize:
+		// オーガナイザー
+		if a.role[2] {
+			a.organizer.Organize(agents, a, summery, effects)
+		}
+
+	case PhaseReproduce:
+		// 再生産
+		a.Reproduce(agents, gaParams, default_agent_params, summery, effects)
+	}
 }
 
-func (a *Agent) Reproduce(agents, new_born_pool *[]*Agent, gaParams *GAParams, default_agent_params *Agent, summery *Summery) {
+func (a *Agent) Reproduce(agents *[]*Agent, gaParams *GAParams, default_agent_params *Agent, summery *Summery, effects *Effects) {
 	// もしエネルギーが default_energy/2 以上なら、reproduction_probability の確率で子供を作る
 	if a.energy < float64(a.default_energy)/2 {
 		return
 	}
 
-	if rand.Float64() < a.reproduction_probability {
+	if a.rng.Float64() < a.reproduction_probability {
 		// default_energy/2 以上の agent を探してランダムに選ぶ
 		spouse_candidates := make([]*Agent, 0)
 		for _, agent := range *agents {
@@ -236,19 +291,40 @@ func (a *Agent) Reproduce(agents, new_born_pool *[]*Agent, gaParams *GAParams, d
 			return
 		}
 
-		spouse := spouse_candidates[rand.IntN(len(spouse_candidates))]
-		child, err := ReproduceGA(a, spouse, gaParams, default_agent_params, MakeNewAgentFromAgent)
+		spouse := spouse_candidates[a.rng.IntN(len(spouse_candidates))]
+		child, err := ReproduceGA(a, spouse, gaParams, default_agent_params, MakeNewAgentFromAgent, a.FrozenGenes(), a.rng)
 		if err == nil {
-			child.id = GetNewID()
-			*new_born_pool = append(*new_born_pool, child)
+			child.Seed(a.rng.Uint64(), a.rng.Uint64())
+			effects.Born(child, a, spouse)
+
+			// 集計 (V)
+			summery.CountBirth(child, a, spouse)
 		}
 
 		// たまに失敗することもあるが、失敗してもエネルギーは減らす
-		a.energy -= float64(a.default_energy) / 2
-		spouse.energy -= float64(a.default_energy) / 2
+		effects.PayReproductionCost(a, float64(a.default_energy)/2)
+		effects.PayReproductionCost(spouse, float64(a.default_energy)/2)
 	}
 }
 
+// ToGene が返す遺伝子の長さ
+const GeneLength = 11
+
+// ToGene が返す遺伝子の各要素の名前 (出力の列名に用いる)
+var GeneNames = [GeneLength]string{
+	"role_creator",
+	"role_listener",
+	"role_organizer",
+	"reproduction_probability",
+	"innovation_rate",
+	"creation_probability",
+	"creator_memory_retention",
+	"novelty_preference",
+	"listening_probability",
+	"listener_memory_retention",
+	"event_probability",
+}
+
 func (a *Agent) ToGene() []float64 {
 	gene := make([]float64, 0)
 
@@ -269,12 +345,16 @@ func (a *Agent) ToGene() []float64 {
 	gene = append(gene, a.creator.innovation_rate)
 	// creation_probability
 	gene = append(gene, a.creator.creation_probability)
+	// memory_retention
+	gene = append(gene, a.creator.memory_retention)
 
 	// listener
 	// novelty_preference
 	gene = append(gene, a.listener.novelty_preference)
 	// listening_probability
 	gene = append(gene, a.listener.listening_probability)
+	// memory_retention
+	gene = append(gene, a.listener.memory_retention)
 
 	// organizer
 	// event_probability
@@ -284,7 +364,7 @@ func (a *Agent) ToGene() []float64 {
 }
 
 func (a *Agent) FromGene(gene []float64) error {
-	if len(gene) != 9 {
+	if len(gene) != GeneLength {
 		return &GeneLengthError{len(gene)}
 	}
 
@@ -310,26 +390,42 @@ func (a *Agent) FromGene(gene []float64) error {
 	a.creator.innovation_rate = gene[4]
 	// creation_probability
 	a.creator.creation_probability = gene[5]
+	// memory_retention
+	a.creator.memory_retention = gene[6]
 
 	// listener
 	// novelty_preference
-	a.listener.novelty_preference = gene[6]
+	a.listener.novelty_preference = gene[7]
 	// listening_probability
-	a.listener.listening_probability = gene[7]
+	a.listener.listening_probability = gene[8]
+	// memory_retention
+	a.listener.memory_retention = gene[9]
 
 	// organizer
 	// event_probability
-	a.organizer.event_probability = gene[8]
+	a.organizer.event_probability = gene[10]
 
 	return nil
 }
 
+// ToGene の遺伝子のうち、進化させないもの (ReproduceGA の frozen)
+// 記憶の容量が進化しない設定では、memory_retention は使われないので進化させない。
+func (a *Agent) FrozenGenes() []bool {
+	if a.creator.memory.Evolvable() && a.listener.memory.Evolvable() {
+		return nil
+	}
+	frozen := make([]bool, GeneLength)
+	frozen[6] = !a.creator.memory.Evolvable()  // creator_memory_retention
+	frozen[9] = !a.listener.memory.Evolvable() // listener_memory_retention
+	return frozen
+}
+
 type GeneLengthError struct {
 	length int
 }
 
 func (e *GeneLengthError) Error() string {
-	return "Gene length is not 9: " + strconv.Itoa(e.length)
+	return "Gene length is not " + strconv.Itoa(GeneLength) + ": " + strconv.Itoa(e.length)
 }
 
 type NoRoleError struct{}
@@ -0,0 +1,176 @@
+package MuSL
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// 同じ設定でシードだけを変えた複数の実行のサマリーを、イテレーションごとに集計したもの
+type Aggregate struct {
+	Fields     []string
+	Iterations []int
+	Runs       []int           // イテレーションごとの、そのイテレーションがある実行の数
+	Stats      [][]*FieldStats // [イテレーション][項目]
+}
+
+// 実行をまたいだ 1 つの項目の統計量 (SD は標本標準偏差、実行が 1 つなら 0)
+type FieldStats struct {
+	Mean float64
+	SD   float64
+	Min  float64
+	Max  float64
+}
+
+type AnalysisFieldError struct {
+	Name string
+}
+
+func (e *AnalysisFieldError) Error() string {
+	return "unknown summery value: " + strconv.Quote(e.Name)
+}
+
+// runs の数値の項目 fields (空ならすべて) を、イテレーションごとに集計する
+// 和は実行の順に取るので、同じ入力なら結果も同じになる。
+func AggregateSummeries(runs [][]*PublicSummery, fields []string) (*Aggregate, error) {
+	if len(fields) == 0 {
+		fields = NumericSummeryFields()
+	}
+	indices := make([]int, len(fields))
+	for i, name := range fields {
+		if indices[i] = numeric_field_index(name); indices[i] < 0 {
+			return nil, &AnalysisFieldError{name}
+		}
+	}
+
+	// イテレーションごとに、各実行の値を集める
+	values := make(map[int][][]float64) // [イテレーション][項目][実行]
+	for _, run := range runs {
+		for _, summery := range run {
+			if _, ok := values[summery.Iteration]; !ok {
+				values[summery.Iteration] = make([][]float64, len(fields))
+			}
+			v := reflect.ValueOf(summery).Elem()
+			for i, index := range indices {
+				values[summery.Iteration][i] = append(values[summery.Iteration][i], numeric_value(v.Field(index)))
+			}
+		}
+	}
+
+	a := &Aggregate{
+		Fields:     fields,
+		Iterations: make([]int, 0, len(values)),
+		Runs:       make([]int, 0, len(values)),
+		Stats:      make([][]*FieldStats, 0, len(values)),
+	}
+	for iteration := range values {
+		a.Iterations = append(a.Iterations, iteration)
+	}
+	sort.Ints(a.Iterations)
+
+	for _, iteration := range a.Iterations {
+		stats := make([]*FieldStats, len(fields))
+		for i, xs := range values[iteration] {
+			stats[i] = measure_values(xs)
+		}
+		a.Runs = append(a.Runs, len(values[iteration][0]))
+		a.Stats = append(a.Stats, stats)
+	}
+	return a, nil
+}
+
+func measure_values(xs []float64) *FieldStats {
+	stats := &FieldStats{Min: math.Inf(1), Max: math.Inf(-1)}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+		stats.Min = min(stats.Min, x)
+		stats.Max = max(stats.Max, x)
+	}
+	stats.Mean = sum / float64(len(xs))
+
+	if len(xs) > 1 {
+		squares := 0.0
+		for _, x := range xs {
+			squares += (x - stats.Mean) * (x - stats.Mean)
+		}
+		stats.SD = math.Sqrt(squares / float64(len(xs)-1))
+	}
+	return stats
+}
+
+// 最後のイテレーションの統計量 (集計するものがなければ nil)
+func (a *Aggregate) Final() []*FieldStats {
+	if len(a.Stats) == 0 {
+		return nil
+	}
+	return a.Stats[len(a.Stats)-1]
+}
+
+// イテレーションごとに 1 行の CSV を書き出す
+// 列は iteration, runs と、項目ごとの <項目>_mean, <項目>_sd, <項目>_min, <項目>_max
+func (a *Aggregate) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(aggregate_header([]string{"iteration", "runs"}, a.Fields)); err != nil {
+		return err
+	}
+	for k, iteration := range a.Iterations {
+		row := aggregate_row([]string{strconv.Itoa(iteration), strconv.Itoa(a.Runs[k])}, a.Stats[k])
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// スイープのパラメータの値ごとに、最後のイテレーションの統計量を 1 行で書き出す
+// 列は <パラメータ>, runs と、項目ごとの <項目>_mean, <項目>_sd, <項目>_min, <項目>_max
+func WriteSweepCSV(w io.Writer, param string, values []string, aggregates []*Aggregate) error {
+	writer := csv.NewWriter(w)
+	if len(aggregates) == 0 {
+		writer.Flush()
+		return writer.Error()
+	}
+	if err := writer.Write(aggregate_header([]string{param, "runs"}, aggregates[0].Fields)); err != nil {
+		return err
+	}
+	for i, a := range aggregates {
+		final := a.Final()
+		if final == nil {
+			continue
+		}
+		row := aggregate_row([]string{values[i], strconv.Itoa(a.Runs[len(a.Runs)-1])}, final)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func aggregate_header(prefix []string, fields []string) []string {
+	header := append([]string{}, prefix...)
+	for _, name := range fields {
+		header = append(header, name+"_mean", name+"_sd", name+"_min", name+"_max")
+	}
+	return header
+}
+
+func aggregate_row(prefix []string, stats []*FieldStats) []string {
+	row := append([]string{}, prefix...)
+	for _, s := range stats {
+		row = append(row,
+			strconv.FormatFloat(s.Mean, 'g', -1, 64),
+			strconv.FormatFloat(s.SD, 'g', -1, 64),
+			strconv.FormatFloat(s.Min, 'g', -1, 64),
+			strconv.FormatFloat(s.Max, 'g', -1, 64),
+		)
+	}
+	return row
+}
@@ -0,0 +1,240 @@
+package MuSL
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"strconv"
+)
+
+// アニメーションの色分け
+const (
+	AnimationLineage = "lineage" // 系統樹の根 (ランダムに生成された祖先の曲) ごと
+	AnimationAge     = "age"     // 作成されてからのイテレーション数
+)
+
+// フレームの大きさ (px)。ジャンル空間 [0, 1]^2 を正方形に描き、下に進み具合を示すバーを置く。
+const (
+	animation_size   = 400
+	animation_margin = 10
+	animation_bar    = 6
+)
+
+// 系統ごとの色 (根の曲の ID で選ぶ)
+var lineage_colors = []color.RGBA{
+	{0x1f, 0x77, 0xb4, 0xff},
+	{0xff, 0x7f, 0x0e, 0xff},
+	{0x2c, 0xa0, 0x2c, 0xff},
+	{0xd6, 0x27, 0x28, 0xff},
+	{0x94, 0x67, 0xbd, 0xff},
+	{0x8c, 0x56, 0x4b, 0xff},
+	{0xe3, 0x77, 0xc2, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff},
+	{0xbc, 0xbd, 0x22, 0xff},
+	{0x17, 0xbe, 0xcf, 0xff},
+}
+
+// 作成されてからの経過の色は、新しい曲 (age_color_new) から古い曲 (age_color_old) へのグラデーションにする
+var (
+	age_color_new = color.RGBA{0xff, 0x7f, 0x0e, 0xff}
+	age_color_old = color.RGBA{0x39, 0x3b, 0x79, 0xff}
+)
+
+const age_color_steps = 32
+
+// アニメーションの描き方
+type AnimationParams struct {
+	every      int    // every イテレーションごとに 1 フレーム
+	point_size int    // 点の半径 (px)
+	color_by   string // 色分け
+	highlight  bool   // そのイテレーションに作成された曲を黒い輪で囲む
+	delay      int    // フレームの間隔 (1/100 秒)
+}
+
+func MakeAnimationParams(every, point_size int, color_by string, highlight bool, delay int) (*AnimationParams, error) {
+	if every < 1 {
+		return nil, errors.New("animation every must be at least 1")
+	}
+	if point_size < 0 || delay < 0 {
+		return nil, errors.New("animation point size and delay must not be negative")
+	}
+	if color_by != AnimationLineage && color_by != AnimationAge {
+		return nil, errors.New("unknown animation color: " + strconv.Quote(color_by))
+	}
+
+	return &AnimationParams{
+		every:      every,
+		point_size: point_size,
+		color_by:   color_by,
+		highlight:  highlight,
+		delay:      delay,
+	}, nil
+}
+
+// 系統樹を読み込む (Simulation.GetPhylogeny を JSON にしたもの)
+func ReadPhylogeny(r io.Reader) ([]*PhylogenyNode, error) {
+	roots := make([]*PhylogenyNode, 0)
+	err := json.NewDecoder(r).Decode(&roots)
+	return roots, err
+}
+
+// アニメーションで描く曲
+type animation_song struct {
+	genre     []float64
+	iteration int
+	extinct   int
+	root_id   int
+}
+
+// イテレーション t の終わりに残っているか
+func (song *animation_song) alive(t int) bool {
+	return song.iteration <= t && (song.extinct < 0 || t < song.extinct)
+}
+
+// 系統樹から、各イテレーションの終わりに残っている曲のジャンルを 1 フレームとするアニメーション GIF を書き出す
+// 曲は作成されたイテレーションから extinct_iteration の前のイテレーションまで描く。
+func WriteGenreAnimation(w io.Writer, roots []*PhylogenyNode, params *AnimationParams) error {
+	songs, last := collect_animation_songs(roots)
+
+	palette := animation_palette()
+	animation := &gif.GIF{}
+	for t := 0; t <= last; t += params.every {
+		frame := image.NewPaletted(image.Rect(0, 0, animation_size, animation_size+animation_bar), palette)
+		draw_animation_frame(frame, songs, t, last, params)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, params.delay)
+	}
+
+	return gif.EncodeAll(w, animation)
+}
+
+// 木をたどって曲を並べ (描く順序は系統ごと)、最後のフレームのイテレーションと一緒に返す
+func collect_animation_songs(roots []*PhylogenyNode) ([]animation_song, int) {
+	songs := make([]animation_song, 0)
+	last := 0
+	var walk func(node *PhylogenyNode, root_id int)
+	walk = func(node *PhylogenyNode, root_id int) {
+		songs = append(songs, animation_song{node.Genre, node.Iteration, node.ExtinctIteration, root_id})
+		last = max(last, node.Iteration, node.ExtinctIteration)
+		for _, child := range node.Children {
+			walk(child, root_id)
+		}
+	}
+	for _, root := range roots {
+		walk(root, root.ID)
+	}
+	return songs, last
+}
+
+// 白、黒、灰色、系統の色、経過のグラデーションからなるパレット
+func animation_palette() color.Palette {
+	palette := color.Palette{
+		color.White,
+		color.Black,
+		color.RGBA{0xc0, 0xc0, 0xc0, 0xff},
+	}
+	for _, c := range lineage_colors {
+		palette = append(palette, c)
+	}
+	for k := range age_color_steps {
+		palette = append(palette, blend_color(age_color_new, age_color_old, float64(k)/(age_color_steps-1)))
+	}
+	return palette
+}
+
+func blend_color(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// イテレーション t のフレームを描く
+func draw_animation_frame(frame *image.Paletted, songs []animation_song, t, last int, params *AnimationParams) {
+	// パレットの番号 (animation_palette)
+	const (
+		black = 1
+		gray  = 2
+	)
+	lineage_index := func(root_id int) uint8 {
+		return uint8(3 + root_id%len(lineage_colors))
+	}
+	age_index := func(age int) uint8 {
+		k := 0
+		if last > 0 {
+			k = age * (age_color_steps - 1) / last
+		}
+		return uint8(3 + len(lineage_colors) + min(k, age_color_steps-1))
+	}
+
+	// ジャンル空間の枠
+	inner := animation_size - 2*animation_margin
+	to_px := func(v float64) int {
+		return animation_margin + int(max(0, min(1, v))*float64(inner-1)+0.5)
+	}
+	for k := animation_margin - 1; k <= animation_size-animation_margin; k++ {
+		frame.SetColorIndex(k, animation_margin-1, gray)
+		frame.SetColorIndex(k, animation_size-animation_margin, gray)
+		frame.SetColorIndex(animation_margin-1, k, gray)
+		frame.SetColorIndex(animation_size-animation_margin, k, gray)
+	}
+
+	// 曲 (縦軸は上が 1)
+	for _, song := range songs {
+		if !song.alive(t) || len(song.genre) < 2 {
+			continue
+		}
+		index := lineage_index(song.root_id)
+		if params.color_by == AnimationAge {
+			index = age_index(t - song.iteration)
+		}
+		fill_disc(frame, to_px(song.genre[0]), animation_size-1-to_px(song.genre[1]), params.point_size, index)
+	}
+
+	// そのイテレーションに作成された曲
+	if params.highlight {
+		for _, song := range songs {
+			if song.iteration != t || !song.alive(t) || len(song.genre) < 2 {
+				continue
+			}
+			draw_ring(frame, to_px(song.genre[0]), animation_size-1-to_px(song.genre[1]), params.point_size+1, black)
+		}
+	}
+
+	// 進み具合
+	width := animation_size
+	if last > 0 {
+		width = t * animation_size / last
+	}
+	for x := range width {
+		for y := animation_size; y < animation_size+animation_bar; y++ {
+			frame.SetColorIndex(x, y, gray)
+		}
+	}
+}
+
+// (cx, cy) を中心とする半径 r の円を塗る (r = 0 なら 1 px)
+func fill_disc(frame *image.Paletted, cx, cy, r int, index uint8) {
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			if dx*dx+dy*dy <= r*r {
+				frame.SetColorIndex(cx+dx, cy+dy, index)
+			}
+		}
+	}
+}
+
+// (cx, cy) を中心とする半径 r の輪を描く
+func draw_ring(frame *image.Paletted, cx, cy, r int, index uint8) {
+	for dy := -r; dy <= r; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			d := dx*dx + dy*dy
+			if d <= r*r && d > (r-1)*(r-1) {
+				frame.SetColorIndex(cx+dx, cy+dy, index)
+			}
+		}
+	}
+}
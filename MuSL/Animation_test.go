@@ -0,0 +1,54 @@
+package MuSL
+
+import (
+	"bytes"
+	"image/gif"
+	"testing"
+)
+
+// 各フレームに描く曲は、そのイテレーションの num_song_now と一致し、最後のイテレーションより後のフレームはない
+func TestAnimationMatchesSongCount(t *testing.T) {
+	for _, seed := range []int64{7, 20} {
+		c := test_config(ScheduleFixed, seed)
+		sim, err := c.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		songs, last := collect_animation_songs(sim.GetPhylogeny())
+		if last > c.NumIterations {
+			t.Errorf("seed %d: last frame %d is after the last iteration %d", seed, last, c.NumIterations)
+		}
+		for _, summery := range sim.GetSummery() {
+			alive := 0
+			for _, song := range songs {
+				if song.alive(summery.Iteration) {
+					alive++
+				}
+			}
+			if alive != summery.NumSongNow {
+				t.Errorf("seed %d, iteration %d: %d songs drawn, num_song_now %d", seed, summery.Iteration, alive, summery.NumSongNow)
+			}
+		}
+
+		params, err := MakeAnimationParams(1, 2, AnimationLineage, true, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer bytes.Buffer
+		if err := WriteGenreAnimation(&buffer, sim.GetPhylogeny(), params); err != nil {
+			t.Fatal(err)
+		}
+		animation, err := gif.DecodeAll(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(animation.Image) != last+1 {
+			t.Errorf("seed %d: %d frames, want %d", seed, len(animation.Image), last+1)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package MuSL
+
+import (
+	"encoding/csv"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// サマリーのスカラー値を、1 イテレーション 1 行の CSV で書き出す
+// 列は PublicSummery のフィールドの順で、ヘッダーは json タグの名前になる。
+// スライスなどのスカラーでないフィールド (AllGenres など) と文字列のフィールド (GenresCompact) は書き出さない。
+// ジャンルのスナップショットは WriteGenreCSV で別に書き出す。
+func WriteSummeryCSV(w io.Writer, summeries []*PublicSummery) error {
+	writer := csv.NewWriter(w)
+
+	t := reflect.TypeFor[PublicSummery]()
+	columns := make([]int, 0)
+	header := make([]string, 0)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !is_scalar(field.Type.Kind()) {
+			continue
+		}
+		columns = append(columns, i)
+		header = append(header, csv_column_name(field))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, summery := range summeries {
+		v := reflect.ValueOf(summery).Elem()
+		row := make([]string, len(columns))
+		for j, i := range columns {
+			row[j] = format_scalar(v.Field(i))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ジャンルのスナップショットを、1 曲 1 行の縦長の CSV で書き出す
+// 列は iteration, song (そのイテレーションでの曲の番号), dim_0, dim_1, ... となる。
+// 圧縮されたスナップショットは展開してから書き出す。
+func WriteGenreCSV(w io.Writer, summeries []*PublicSummery) error {
+	// compact のジャンルは展開して書くが、summeries は変更しない
+	genres := make([][][]float64, len(summeries))
+	for i, summery := range summeries {
+		var err error
+		if genres[i], err = summery.Genres(); err != nil {
+			return err
+		}
+	}
+	writer := csv.NewWriter(w)
+
+	// 次元数は最大のものに合わせる
+	dim := 0
+	for _, snapshot := range genres {
+		for _, genre := range snapshot {
+			dim = max(dim, len(genre))
+		}
+	}
+
+	header := []string{"iteration", "song"}
+	for d := range dim {
+		header = append(header, "dim_"+strconv.Itoa(d))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for k, summery := range summeries {
+		for i, genre := range genres[k] {
+			row := make([]string, 2+dim)
+			row[0] = strconv.Itoa(summery.Iteration)
+			row[1] = strconv.Itoa(i)
+			for d, value := range genre {
+				row[2+d] = strconv.FormatFloat(value, 'g', -1, 64)
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// 数値 (bool を含む) のフィールド
+func is_scalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// json タグがあればその名前、なければフィールド名
+func csv_column_name(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// PublicSummery の数値の項目 (bool は 0 か 1) の名前
+func NumericSummeryFields() []string {
+	t := reflect.TypeFor[PublicSummery]()
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		if is_scalar(t.Field(i).Type.Kind()) {
+			names = append(names, csv_column_name(t.Field(i)))
+		}
+	}
+	return names
+}
+
+// 数値の項目の、PublicSummery でのフィールドの番号 (なければ -1)
+func numeric_field_index(name string) int {
+	t := reflect.TypeFor[PublicSummery]()
+	for i := range t.NumField() {
+		if is_scalar(t.Field(i).Type.Kind()) && csv_column_name(t.Field(i)) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func numeric_value(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int64:
+		return float64(v.Int())
+	default:
+		return v.Float()
+	}
+}
+
+func format_scalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	default:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+}
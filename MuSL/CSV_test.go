@@ -0,0 +1,46 @@
+package MuSL
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+)
+
+// サマリーの CSV の列は数値の項目だけで、ジャンルのスナップショットは含まない
+func TestWriteSummeryCSVHeader(t *testing.T) {
+	summeries := []*PublicSummery{
+		{Iteration: 0, AllGenres: [][]float64{{0.1, 0.2}}},
+		{Iteration: 1, GenresCompact: EncodeGenres([][]float64{{0.3, 0.4}})},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteSummeryCSV(&buffer, summeries); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(summeries)+1 {
+		t.Fatalf("%d rows, want %d", len(rows), len(summeries)+1)
+	}
+
+	header := rows[0]
+	if !slices.Equal(header, NumericSummeryFields()) {
+		t.Errorf("header %v, want %v", header, NumericSummeryFields())
+	}
+	for _, name := range []string{"iteration", "num_population", "income_gained_all", "income_theil"} {
+		if !slices.Contains(header, name) {
+			t.Errorf("header has no %s column", name)
+		}
+	}
+	for _, name := range []string{"genres_compact", "AllGenres", "role_census", "income_decomposition", "gene_distribution"} {
+		if slices.Contains(header, name) {
+			t.Errorf("header has a %s column", name)
+		}
+	}
+	if rows[2][0] != "1" {
+		t.Errorf("iteration of the second row is %s", rows[2][0])
+	}
+}
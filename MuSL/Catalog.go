@@ -0,0 +1,48 @@
+package MuSL
+
+// 楽曲カタログの 1 行
+// ヒット曲や人気の分析のため、曲ごとの集計値をまとめたもの
+type CatalogEntry struct {
+	ID             int     `json:"id"`
+	CreatorID      int     `json:"creator_id"`
+	Iteration      int     `json:"iteration"`
+	NumEvents      int     `json:"num_events"`
+	NumEvaluations int     `json:"num_evaluations"`
+	MeanEvaluation float64 `json:"mean_evaluation"`
+	VarEvaluation  float64 `json:"var_evaluation"`
+	TotalReward    float64 `json:"total_reward"`
+	WonMajor       bool    `json:"won_major"`
+}
+
+// 楽曲のリストからカタログを作成する
+func BuildSongCatalog(songs []*Song) []*CatalogEntry {
+	catalog := make([]*CatalogEntry, len(songs))
+	for i, song := range songs {
+		stats := song.stats
+
+		// 評価の平均と分散 (評価がない場合は 0)
+		mean := 0.0
+		variance := 0.0
+		if stats.num_evaluations > 0 {
+			n := float64(stats.num_evaluations)
+			mean = stats.sum_evaluation / n
+			variance = stats.sum_sq_evaluation/n - mean*mean
+			if variance < 0 { // 丸め誤差対策
+				variance = 0
+			}
+		}
+
+		catalog[i] = &CatalogEntry{
+			ID:             song.id,
+			CreatorID:      song.creator_id,
+			Iteration:      song.iteration,
+			NumEvents:      stats.num_events,
+			NumEvaluations: stats.num_evaluations,
+			MeanEvaluation: mean,
+			VarEvaluation:  variance,
+			TotalReward:    stats.total_reward,
+			WonMajor:       stats.won_major,
+		}
+	}
+	return catalog
+}
@@ -0,0 +1,777 @@
+package MuSL
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
+)
+
+// チェックポイントの形式のバージョン。形式を変えたら上げる。
+const checkpoint_version = 4
+
+// チェックポイントに保存するシミュレーションの全状態
+// ポインタで共有されている Song, Event, Agent は ID で参照し、読み込み時につなぎ直す。
+// gob で書き込むため、フィールドは公開する。
+type checkpoint struct {
+	Version   int
+	Iteration int
+	NIter     int
+	Seed      uint64
+
+	// ID のカウンタと乱数生成器の状態
+	IDCounter      int
+	SongIDCounter  int
+	EventIDCounter int
+	Src            []byte
+	SnapshotSrc    []byte
+
+	// 実験の設定
+	MutationRate     float64
+	MutationStrength float64
+	Default          checkpoint_agent // default_agent_params
+	CreatorMemory    checkpoint_memory_params
+	ListenerMemory   checkpoint_memory_params
+	Scheduler        string
+	Parallel         bool
+	Workers          int
+	GenreEvery       int
+	GenreAt          []int
+	GenreSample      int
+	GenreEncoding    string
+	DiversityGrid    int
+	RetainSummery    bool
+
+	// 動的に変化する状態
+	Songs     []checkpoint_song // いままで作成されたすべての楽曲
+	Events    []checkpoint_event
+	Agents    []checkpoint_agent
+	Summeries []checkpoint_summery
+}
+
+type checkpoint_memory_params struct {
+	Capacity  float64
+	Policy    string
+	DecayRate float64
+	Evolvable bool
+	Indexed   bool
+}
+
+type checkpoint_memory struct {
+	Songs   []int
+	Weights []float64
+}
+
+type checkpoint_song struct {
+	ID               int
+	ParentID         int
+	Iteration        int
+	ExtinctIteration int
+	Genre            []float64
+	CreatorID        int
+	NumEvents        int
+	NumEvaluations   int
+	SumEvaluation    float64
+	SumSqEvaluation  float64
+	TotalReward      float64
+	WonMajor         bool
+}
+
+type checkpoint_event struct {
+	ID                 int
+	OrganizerID        int
+	Iteration          int
+	Type               string
+	Songs              []int       // creator_pool
+	Listeners          []int       // listener_pool
+	Evaluations        [][]float64 // Songs の順の evaluation_pool
+	Rewards            []float64   // Songs の順の evaluation_reward
+	NumRecommendations int
+	Fee                float64
+	OrganizerIncome    float64
+}
+
+type checkpoint_agent struct {
+	ID                      int
+	Role                    []bool
+	Energy                  float64
+	DefaultEnergy           float64
+	EliminationThreshold    float64
+	ReproductionProbability float64
+	Src                     []byte
+
+	// creator
+	InnovationRate      float64
+	CreatorMemory       checkpoint_memory
+	CreationProbability float64
+	CreatorRetention    float64
+	CreationCost        float64
+
+	// listener
+	NoveltyPreference    float64
+	ListenerMemory       checkpoint_memory
+	IncomingSongs        []int
+	SongEvents           []int
+	ListeningProbability float64
+	ListenerRetention    float64
+	EvaluationCost       float64
+
+	// organizer
+	MajorProbability         float64
+	CreatedEvents            []int
+	EventProbability         float64
+	OrganizationCost         float64
+	OrganizationReward       float64
+	MajorListenerRatio       float64
+	MajorCreatorRatio        float64
+	MajorSongRatio           float64
+	MajorWinnerRatio         float64
+	MajorRewardRatio         float64
+	MajorRecommendationRatio float64
+	MinorListenerRatio       float64
+	MinorCreatorRatio        float64
+	MinorSongRatio           float64
+	MinorRewardRatio         float64
+	MinorRecommendationRatio float64
+}
+
+type checkpoint_summery struct {
+	Retained bool // false なら SetRetainSummery(false) で捨てられたもの
+	Summery  PublicSummery
+}
+
+// チェックポイントを file_name に保存する
+// 書き込み中に中断されても前のチェックポイントが壊れないよう、一時ファイルに書いてから置き換える
+func (s *Simulation) SaveCheckpointFile(file_name string) error {
+	tmp_name := file_name + ".tmp"
+	file, err := os.Create(tmp_name)
+	if err != nil {
+		return err
+	}
+
+	if err := s.SaveCheckpoint(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp_name, file_name)
+}
+
+// file_name のチェックポイントからシミュレーションを復元する
+func LoadCheckpointFile(file_name string) (*Simulation, error) {
+	file, err := os.Open(file_name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadCheckpoint(file)
+}
+
+// シミュレーションの全状態を gzip で圧縮した gob で w に書き込む
+// 通知先 (observers) とチェックポイントの設定は保存しない
+func (s *Simulation) SaveCheckpoint(w io.Writer) error {
+	scheduler, err := scheduler_name(s.scheduler)
+	if err != nil {
+		return err
+	}
+
+	c := &checkpoint{
+		Version:          checkpoint_version,
+		Iteration:        s.iteration,
+		NIter:            s.n_iter,
+		Seed:             s.seed,
+		IDCounter:        int(global_id_counter.Load()),
+		SongIDCounter:    int(global_song_id_counter.Load()),
+		EventIDCounter:   int(global_event_id_counter.Load()),
+		MutationRate:     s.ga_params.mutation_rate,
+		MutationStrength: s.ga_params.mutation_strength,
+		Default:          save_agent(s.default_agent_params),
+		CreatorMemory:    save_memory_params(s.default_agent_params.creator.memory),
+		ListenerMemory:   save_memory_params(s.default_agent_params.listener.memory),
+		Scheduler:        scheduler,
+		Parallel:         s.parallel,
+		Workers:          s.workers,
+		GenreEvery:       s.genre_snapshot.every,
+		GenreAt:          make([]int, 0, len(s.genre_snapshot.at)),
+		GenreSample:      s.genre_snapshot.sample,
+		GenreEncoding:    s.genre_snapshot.encoding,
+		DiversityGrid:    s.diversity_grid,
+		RetainSummery:    s.retain_summery,
+		Songs:            make([]checkpoint_song, len(s.songs)),
+		Events:           make([]checkpoint_event, 0),
+		Agents:           make([]checkpoint_agent, len(s.agents)),
+		Summeries:        make([]checkpoint_summery, s.iteration+1),
+	}
+
+	if c.Src, err = s.src.MarshalBinary(); err != nil {
+		return err
+	}
+	if c.SnapshotSrc, err = s.snapshot_src.MarshalBinary(); err != nil {
+		return err
+	}
+
+	for iteration := range s.genre_snapshot.at {
+		c.GenreAt = append(c.GenreAt, iteration)
+	}
+	slices.Sort(c.GenreAt)
+
+	for i, song := range s.songs {
+		c.Songs[i] = save_song(song)
+	}
+
+	// リスナーに届いている曲のイベントと、精算前のイベントを保存する
+	saved_events := make(map[*Event]bool)
+	save_events := func(events []*Event) {
+		for _, event := range events {
+			if !saved_events[event] {
+				saved_events[event] = true
+				c.Events = append(c.Events, save_event(event))
+			}
+		}
+	}
+	for i, agent := range s.agents {
+		c.Agents[i] = save_agent(agent)
+		save_events(agent.listener.song_events)
+		save_events(agent.organizer.created_events)
+	}
+
+	for i := range c.Summeries {
+		if s.summery[i] != nil {
+			c.Summeries[i] = checkpoint_summery{true, *s.summery[i].Publish()}
+		}
+	}
+
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(c); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// SaveCheckpoint で書き込んだ状態からシミュレーションを復元する
+// ID のカウンタはチェックポイントの値まで進める (戻さないので、同じプロセスの他のシミュレーションと ID は重複しない)
+// 新しいプロセスで再開すれば、中断しなかった場合と同じ ID になる
+func LoadCheckpoint(r io.Reader) (*Simulation, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	c := &checkpoint{}
+	if err := gob.NewDecoder(zr).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Version != checkpoint_version {
+		return nil, &CheckpointVersionError{c.Version}
+	}
+
+	scheduler, err := MakeScheduler(c.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+	genre_snapshot, err := MakeGenreSnapshotParams(c.GenreEvery, c.GenreAt, c.GenreSample, c.GenreEncoding)
+	if err != nil {
+		return nil, err
+	}
+	creator_memory, err := load_memory_params(c.CreatorMemory)
+	if err != nil {
+		return nil, err
+	}
+	listener_memory, err := load_memory_params(c.ListenerMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	// 楽曲を復元 (作成者はエージェントの復元後につなぐ)
+	songs := make([]*Song, len(c.Songs))
+	song_by_id := make(map[int]*Song, len(c.Songs))
+	for i, cs := range c.Songs {
+		songs[i] = cs.load()
+		song_by_id[cs.ID] = songs[i]
+	}
+
+	// イベントを復元 (リスナーはエージェントの復元後につなぐ)
+	event_by_id := make(map[int]*Event, len(c.Events))
+	for _, ce := range c.Events {
+		event, err := ce.load(song_by_id)
+		if err != nil {
+			return nil, err
+		}
+		event_by_id[ce.ID] = event
+	}
+
+	// エージェントを復元
+	default_agent_params, err := c.Default.load(creator_memory, listener_memory, song_by_id, event_by_id)
+	if err != nil {
+		return nil, err
+	}
+	agents := make([]*Agent, len(c.Agents))
+	agent_by_id := make(map[int]*Agent, len(c.Agents))
+	for i, ca := range c.Agents {
+		agent, err := ca.load(default_agent_params.creator.memory, default_agent_params.listener.memory, song_by_id, event_by_id)
+		if err != nil {
+			return nil, err
+		}
+		agents[i] = agent
+		agent_by_id[ca.ID] = agent
+	}
+
+	// すでに削除されたエージェントは、参照をつなぐためだけの (エネルギー 0 の) エージェントで置き換える
+	find_agent := func(id int) *Agent {
+		if agent, ok := agent_by_id[id]; ok {
+			return agent
+		}
+		agent := MakeNewAgentFromAgent(default_agent_params)
+		agent.id = id
+		agent.energy = 0
+		agent_by_id[id] = agent
+		return agent
+	}
+	for i, cs := range c.Songs {
+		songs[i].creator = find_agent(cs.CreatorID)
+	}
+	for _, ce := range c.Events {
+		event := event_by_id[ce.ID]
+		for _, id := range ce.Listeners {
+			event.listener_pool = append(event.listener_pool, find_agent(id))
+		}
+	}
+
+	src := &rand.PCG{}
+	if err := src.UnmarshalBinary(c.Src); err != nil {
+		return nil, err
+	}
+	snapshot_src := &rand.PCG{}
+	if err := snapshot_src.UnmarshalBinary(c.SnapshotSrc); err != nil {
+		return nil, err
+	}
+	if c.NIter < 0 || len(c.Summeries) > c.NIter+1 {
+		return nil, &CheckpointLengthError{"summeries", len(c.Summeries), c.NIter + 1}
+	}
+
+	sim := &Simulation{
+		agents:               agents,
+		n_iter:               c.NIter,
+		iteration:            c.Iteration,
+		ga_params:            MakeGAParams(c.MutationRate, c.MutationStrength),
+		default_agent_params: default_agent_params,
+		summery:              make([]*Summery, c.NIter+1),
+		songs:                songs,
+		seed:                 c.Seed,
+		src:                  src,
+		rng:                  rand.New(src),
+		scheduler:            scheduler,
+		parallel:             c.Parallel,
+		workers:              max(1, c.Workers),
+		observers:            make([]SimulationObserver, 0),
+		genre_snapshot:       genre_snapshot,
+		snapshot_src:         snapshot_src,
+		snapshot_rng:         rand.New(snapshot_src),
+		diversity_grid:       c.DiversityGrid,
+		retain_summery:       c.RetainSummery,
+		checkpoint_file:      "",
+		checkpoint_every:     0,
+		started:              c.Iteration > 0,
+		verbose:              true,
+	}
+	for i, cs := range c.Summeries {
+		if cs.Retained {
+			sim.summery[i] = MakeSummeryFromPublic(&cs.Summery)
+		}
+	}
+
+	// 同じプロセスの他のシミュレーションと ID が重ならないよう、カウンターは戻さずに、チェックポイントの値まで進めるだけにする
+	raise_counter(&global_id_counter, int64(c.IDCounter))
+	raise_counter(&global_song_id_counter, int64(c.SongIDCounter))
+	raise_counter(&global_event_id_counter, int64(c.EventIDCounter))
+
+	return sim, nil
+}
+
+// counter を value 以上にする
+func raise_counter(counter *atomic.Int64, value int64) {
+	for {
+		current := counter.Load()
+		if current >= value || counter.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+// MakeScheduler に渡す名前を返す
+func scheduler_name(scheduler Scheduler) (string, error) {
+	switch scheduler.(type) {
+	case *FixedScheduler:
+		return ScheduleFixed, nil
+	case *RandomScheduler:
+		return ScheduleRandom, nil
+	case *RolePhasedScheduler:
+		return ScheduleRolePhased, nil
+	case *SynchronousScheduler:
+		return ScheduleSynchronous, nil
+	default:
+		return "", &CheckpointSchedulerError{}
+	}
+}
+
+func save_memory_params(m *SongMemory) checkpoint_memory_params {
+	return checkpoint_memory_params{
+		Capacity:  float64(m.params.capacity),
+		Policy:    m.params.policy,
+		DecayRate: float64(m.params.decay_rate),
+		Evolvable: m.params.evolvable,
+		Indexed:   m.index != nil,
+	}
+}
+
+// 空の記憶を返す。エージェントの記憶はこれを EmptyCopy して作る。
+func load_memory_params(cp checkpoint_memory_params) (*SongMemory, error) {
+	params, err := MakeMemoryParams(int(cp.Capacity), cp.Policy, cp.DecayRate, cp.Evolvable)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Indexed {
+		return MakeNewIndexedSongMemory(params), nil
+	}
+	return MakeNewSongMemory(params), nil
+}
+
+func save_memory(m *SongMemory) checkpoint_memory {
+	return checkpoint_memory{
+		Songs:   song_ids(m.songs),
+		Weights: m.weights,
+	}
+}
+
+// empty を EmptyCopy して、記憶していた曲を同じ順に入れ直す
+// k-d 木の形は元と変わりうるが、最近傍の距離は同じになる
+func (cm checkpoint_memory) load(empty *SongMemory, song_by_id map[int]*Song) (*SongMemory, error) {
+	m := empty.EmptyCopy()
+	songs, err := find_songs(cm.Songs, song_by_id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cm.Weights) != len(songs) {
+		return nil, &CheckpointLengthError{"memory weights", len(cm.Weights), len(songs)}
+	}
+	for i, song := range songs {
+		m.songs = append(m.songs, song)
+		m.weights = append(m.weights, cm.Weights[i])
+		if m.index != nil {
+			m.nodes = append(m.nodes, m.index.Insert(song))
+		}
+	}
+	return m, nil
+}
+
+func save_song(song *Song) checkpoint_song {
+	return checkpoint_song{
+		ID:               song.id,
+		ParentID:         song.parent_id,
+		Iteration:        song.iteration,
+		ExtinctIteration: song.extinct_iteration,
+		Genre:            song.genre,
+		CreatorID:        song.creator_id,
+		NumEvents:        song.stats.num_events,
+		NumEvaluations:   song.stats.num_evaluations,
+		SumEvaluation:    song.stats.sum_evaluation,
+		SumSqEvaluation:  song.stats.sum_sq_evaluation,
+		TotalReward:      song.stats.total_reward,
+		WonMajor:         song.stats.won_major,
+	}
+}
+
+func (cs checkpoint_song) load() *Song {
+	return &Song{
+		id:                cs.ID,
+		parent_id:         cs.ParentID,
+		iteration:         cs.Iteration,
+		extinct_iteration: cs.ExtinctIteration,
+		genre:             cs.Genre,
+		creator:           nil,
+		creator_id:        cs.CreatorID,
+		stats: SongStats{
+			num_events:        cs.NumEvents,
+			num_evaluations:   cs.NumEvaluations,
+			sum_evaluation:    cs.SumEvaluation,
+			sum_sq_evaluation: cs.SumSqEvaluation,
+			total_reward:      cs.TotalReward,
+			won_major:         cs.WonMajor,
+		},
+	}
+}
+
+func save_event(event *Event) checkpoint_event {
+	ce := checkpoint_event{
+		ID:                 event.id,
+		OrganizerID:        event.organizer_id,
+		Iteration:          event.iteration,
+		Type:               event.event_type,
+		Songs:              song_ids(event.creator_pool),
+		Listeners:          agent_ids(event.listener_pool),
+		Evaluations:        make([][]float64, len(event.creator_pool)),
+		Rewards:            make([]float64, len(event.creator_pool)),
+		NumRecommendations: event.num_recommendations,
+		Fee:                event.fee,
+		OrganizerIncome:    event.organizer_income,
+	}
+	for i, song := range event.creator_pool {
+		ce.Evaluations[i] = event.evaluation_pool[song]
+		ce.Rewards[i] = event.evaluation_reward[song]
+	}
+	return ce
+}
+
+func (ce checkpoint_event) load(song_by_id map[int]*Song) (*Event, error) {
+	creator_pool, err := find_songs(ce.Songs, song_by_id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ce.Evaluations) != len(creator_pool) {
+		return nil, &CheckpointLengthError{"event evaluations", len(ce.Evaluations), len(creator_pool)}
+	}
+	if len(ce.Rewards) != len(creator_pool) {
+		return nil, &CheckpointLengthError{"event rewards", len(ce.Rewards), len(creator_pool)}
+	}
+
+	event := &Event{
+		id:                  ce.ID,
+		organizer_id:        ce.OrganizerID,
+		iteration:           ce.Iteration,
+		event_type:          ce.Type,
+		creator_pool:        creator_pool,
+		listener_pool:       make([]*Agent, 0, len(ce.Listeners)),
+		evaluation_pool:     make(map[*Song][]float64, len(creator_pool)),
+		evaluation_reward:   make(map[*Song]float64, len(creator_pool)),
+		num_recommendations: ce.NumRecommendations,
+		fee:                 ce.Fee,
+		organizer_income:    ce.OrganizerIncome,
+	}
+	for i, song := range creator_pool {
+		event.evaluation_pool[song] = append(make([]float64, 0, len(ce.Evaluations[i])), ce.Evaluations[i]...)
+		event.evaluation_reward[song] = ce.Rewards[i]
+	}
+	return event, nil
+}
+
+func save_agent(a *Agent) checkpoint_agent {
+	ca := checkpoint_agent{
+		ID:                      a.id,
+		Role:                    a.role,
+		Energy:                  a.energy,
+		DefaultEnergy:           float64(a.default_energy),
+		EliminationThreshold:    float64(a.elimination_threshold),
+		ReproductionProbability: a.reproduction_probability,
+
+		InnovationRate:      a.creator.innovation_rate,
+		CreatorMemory:       save_memory(a.creator.memory),
+		CreationProbability: a.creator.creation_probability,
+		CreatorRetention:    a.creator.memory_retention,
+		CreationCost:        float64(a.creator.creation_cost),
+
+		NoveltyPreference:    a.listener.novelty_preference,
+		ListenerMemory:       save_memory(a.listener.memory),
+		IncomingSongs:        song_ids(a.listener.incoming_songs),
+		SongEvents:           event_ids(a.listener.song_events),
+		ListeningProbability: a.listener.listening_probability,
+		ListenerRetention:    a.listener.memory_retention,
+		EvaluationCost:       float64(a.listener.evaluation_cost),
+
+		MajorProbability:         float64(a.organizer.major_probability),
+		CreatedEvents:            event_ids(a.organizer.created_events),
+		EventProbability:         a.organizer.event_probability,
+		OrganizationCost:         float64(a.organizer.organization_cost),
+		OrganizationReward:       float64(a.organizer.organization_reward),
+		MajorListenerRatio:       float64(a.organizer.major_listener_ratio),
+		MajorCreatorRatio:        float64(a.organizer.major_creator_ratio),
+		MajorSongRatio:           float64(a.organizer.major_song_ratio),
+		MajorWinnerRatio:         float64(a.organizer.major_winner_ratio),
+		MajorRewardRatio:         float64(a.organizer.major_reward_ratio),
+		MajorRecommendationRatio: float64(a.organizer.major_recommendation_ratio),
+		MinorListenerRatio:       float64(a.organizer.minor_listener_ratio),
+		MinorCreatorRatio:        float64(a.organizer.minor_creator_ratio),
+		MinorSongRatio:           float64(a.organizer.minor_song_ratio),
+		MinorRewardRatio:         float64(a.organizer.minor_reward_ratio),
+		MinorRecommendationRatio: float64(a.organizer.minor_recommendation_ratio),
+	}
+
+	// default_agent_params は乱数生成器を持たない
+	if a.src != nil {
+		ca.Src, _ = a.src.MarshalBinary()
+	}
+	return ca
+}
+
+// 記憶は creator_memory, listener_memory を EmptyCopy して作る
+func (ca checkpoint_agent) load(creator_memory, listener_memory *SongMemory, song_by_id map[int]*Song, event_by_id map[int]*Event) (*Agent, error) {
+	memory_c, err := ca.CreatorMemory.load(creator_memory, song_by_id)
+	if err != nil {
+		return nil, err
+	}
+	memory_l, err := ca.ListenerMemory.load(listener_memory, song_by_id)
+	if err != nil {
+		return nil, err
+	}
+	incoming_songs, err := find_songs(ca.IncomingSongs, song_by_id)
+	if err != nil {
+		return nil, err
+	}
+	song_events, err := find_events(ca.SongEvents, event_by_id)
+	if err != nil {
+		return nil, err
+	}
+	created_events, err := find_events(ca.CreatedEvents, event_by_id)
+	if err != nil {
+		return nil, err
+	}
+
+	agent := MakeNewAgent(
+		ca.ID,
+		ca.Role,
+		ca.Energy,
+		Const64(ca.DefaultEnergy),
+		Const64(ca.EliminationThreshold),
+		ca.ReproductionProbability,
+
+		// creator
+		ca.InnovationRate,
+		memory_c,
+		ca.CreationProbability,
+		ca.CreatorRetention,
+		Const64(ca.CreationCost),
+
+		// listener
+		ca.NoveltyPreference,
+		memory_l,
+		incoming_songs,
+		song_events,
+		ca.ListeningProbability,
+		ca.ListenerRetention,
+		Const64(ca.EvaluationCost),
+
+		// organizer
+		Const64(ca.MajorProbability),
+		created_events,
+		ca.EventProbability,
+		Const64(ca.OrganizationCost),
+		Const64(ca.OrganizationReward),
+
+		// イベント生成用のパラメータ
+		// メジャーイベント
+		Const64(ca.MajorListenerRatio),
+		Const64(ca.MajorCreatorRatio),
+		Const64(ca.MajorSongRatio),
+		Const64(ca.MajorWinnerRatio),
+		Const64(ca.MajorRewardRatio),
+		Const64(ca.MajorRecommendationRatio),
+
+		// マイナーイベント
+		Const64(ca.MinorListenerRatio),
+		Const64(ca.MinorCreatorRatio),
+		Const64(ca.MinorSongRatio),
+		Const64(ca.MinorRewardRatio),
+		Const64(ca.MinorRecommendationRatio),
+	)
+
+	// MakeNewAgent はエネルギーを default_energy にするので戻す
+	agent.energy = ca.Energy
+
+	if ca.Src != nil {
+		agent.src = &rand.PCG{}
+		if err := agent.src.UnmarshalBinary(ca.Src); err != nil {
+			return nil, err
+		}
+		agent.rng = rand.New(agent.src)
+	}
+	return agent, nil
+}
+
+func song_ids(songs []*Song) []int {
+	ids := make([]int, len(songs))
+	for i, song := range songs {
+		ids[i] = song.id
+	}
+	return ids
+}
+
+func agent_ids(agents []*Agent) []int {
+	ids := make([]int, len(agents))
+	for i, agent := range agents {
+		ids[i] = agent.id
+	}
+	return ids
+}
+
+func event_ids(events []*Event) []int {
+	ids := make([]int, len(events))
+	for i, event := range events {
+		ids[i] = event.id
+	}
+	return ids
+}
+
+func find_songs(ids []int, song_by_id map[int]*Song) ([]*Song, error) {
+	songs := make([]*Song, len(ids))
+	for i, id := range ids {
+		song, ok := song_by_id[id]
+		if !ok {
+			return nil, &CheckpointReferenceError{"song", id}
+		}
+		songs[i] = song
+	}
+	return songs, nil
+}
+
+func find_events(ids []int, event_by_id map[int]*Event) ([]*Event, error) {
+	events := make([]*Event, len(ids))
+	for i, id := range ids {
+		event, ok := event_by_id[id]
+		if !ok {
+			return nil, &CheckpointReferenceError{"event", id}
+		}
+		events[i] = event
+	}
+	return events, nil
+}
+
+type CheckpointVersionError struct {
+	version int
+}
+
+func (e *CheckpointVersionError) Error() string {
+	return "Unsupported checkpoint version: " + strconv.Itoa(e.version)
+}
+
+type CheckpointSchedulerError struct{}
+
+func (e *CheckpointSchedulerError) Error() string {
+	return "Checkpoint supports only schedulers made by MakeScheduler"
+}
+
+// チェックポイントの中で、長さが揃っているはずのリストの長さが合わない
+type CheckpointLengthError struct {
+	kind   string
+	length int
+	want   int
+}
+
+func (e *CheckpointLengthError) Error() string {
+	return "Checkpoint has " + strconv.Itoa(e.length) + " " + e.kind + ", want " + strconv.Itoa(e.want)
+}
+
+type CheckpointReferenceError struct {
+	kind string
+	id   int
+}
+
+func (e *CheckpointReferenceError) Error() string {
+	return "Checkpoint refers to an unknown " + e.kind + ": " + strconv.Itoa(e.id)
+}
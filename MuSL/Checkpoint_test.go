@@ -0,0 +1,266 @@
+package MuSL
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+)
+
+// ID のカウンターを 0 に戻し、新しいプロセスで実行した場合と同じ ID にする
+func reset_id_counters() {
+	global_id_counter.Store(0)
+	global_song_id_counter.Store(0)
+	global_event_id_counter.Store(0)
+}
+
+// サマリー、系統樹、楽曲カタログを JSON にまとめる
+func simulation_outputs(t *testing.T, sim *Simulation) map[string]string {
+	t.Helper()
+
+	outputs := map[string]any{
+		"summery":   sim.GetSummery(),
+		"phylogeny": sim.GetPhylogeny(),
+		"catalog":   sim.GetSongCatalog(),
+	}
+	result := make(map[string]string, len(outputs))
+	for name, value := range outputs {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[name] = string(data)
+	}
+	return result
+}
+
+// 途中のチェックポイントから再開した結果は、中断しなかった場合と同じになる
+func TestCheckpointResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    func(c *SimulationConfig)
+		seed      int64
+		stop      int // チェックポイントを取るイテレーション
+		scheduler string
+	}{
+		{"fixed", func(c *SimulationConfig) {}, 1, 10, ScheduleFixed},
+		{"random", func(c *SimulationConfig) {}, 2, 15, ScheduleRandom},
+		{"role", func(c *SimulationConfig) {}, 3, 1, ScheduleRolePhased},
+		{"synchronous parallel", func(c *SimulationConfig) { c.Parallel = true; c.Workers = 4 }, 4, 20, ScheduleSynchronous},
+		{"decay memory", func(c *SimulationConfig) {
+			c.MemoryCapacity = 5
+			c.MemoryPolicy = ForgetDecay
+			c.MemoryEvolvable = true
+		}, 5, 12, ScheduleFixed},
+		{"compact sampled snapshot", func(c *SimulationConfig) {
+			c.GenreEvery = 3
+			c.GenreSample = 20
+			c.GenreEncoding = GenreCompact
+		}, 6, 14, ScheduleFixed},
+		{"before the start", func(c *SimulationConfig) {}, 7, 0, ScheduleFixed},
+		{"at the end", func(c *SimulationConfig) {}, 8, 30, ScheduleFixed},
+	}
+
+	for _, test := range tests {
+		c := test_config(test.scheduler, test.seed)
+		test.config(c)
+
+		reset_id_counters()
+		sim, err := c.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+		if _, err := sim.Advance(test.stop); err != nil {
+			t.Fatal(err)
+		}
+		var checkpoint bytes.Buffer
+		if err := sim.SaveCheckpoint(&checkpoint); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		// 別のプロセスで再開する
+		reset_id_counters()
+		resumed, err := LoadCheckpoint(&checkpoint)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		resumed.SetVerbose(false)
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := simulation_outputs(t, sim)
+		got := simulation_outputs(t, resumed)
+		for _, name := range []string{"summery", "phylogeny", "catalog"} {
+			if got[name] != want[name] {
+				t.Errorf("%s: resumed %s differs from the uninterrupted one", test.name, name)
+			}
+		}
+	}
+}
+
+func TestLoadCheckpointBroken(t *testing.T) {
+	sim, err := test_config(ScheduleFixed, 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkpoint bytes.Buffer
+	if err := sim.SaveCheckpoint(&checkpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not gzip", []byte("checkpoint")},
+		{"truncated", checkpoint.Bytes()[:checkpoint.Len()/2]},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadCheckpoint(bytes.NewReader(test.data)); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+// チェックポイントを読み込んでも、同じプロセスの他のシミュレーションの ID と重ならない
+func TestLoadCheckpointKeepsIDCounters(t *testing.T) {
+	sim, err := test_config(ScheduleFixed, 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	if _, err := sim.Advance(5); err != nil {
+		t.Fatal(err)
+	}
+	var checkpoint bytes.Buffer
+	if err := sim.SaveCheckpoint(&checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data := checkpoint.Bytes()
+
+	counters := []*atomic.Int64{&global_id_counter, &global_song_id_counter, &global_event_id_counter}
+	before := make([]int64, len(counters))
+	for i, counter := range counters {
+		before[i] = counter.Load()
+	}
+	if _, err := LoadCheckpoint(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for i, counter := range counters {
+		if counter.Load() != before[i] {
+			t.Errorf("counter %d moved from %d to %d", i, before[i], counter.Load())
+		}
+	}
+
+	// 新しいプロセスではチェックポイントの値まで進める
+	reset_id_counters()
+	if _, err := LoadCheckpoint(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if global_id_counter.Load() == 0 || global_song_id_counter.Load() == 0 || global_event_id_counter.Load() == 0 {
+		t.Error("counters were not raised to the checkpoint")
+	}
+}
+
+// 記憶やイベントのリストの長さが合わないチェックポイントは、panic せずにエラーになる
+func TestLoadCheckpointMismatchedLengths(t *testing.T) {
+	sim, err := test_config(ScheduleFixed, 2).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	if _, err := sim.Advance(8); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := sim.SaveCheckpoint(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	tests := []struct {
+		name    string
+		corrupt func(c *checkpoint) bool // 壊せなければ false
+	}{
+		{"memory weights", func(c *checkpoint) bool {
+			for i := range c.Agents {
+				if m := &c.Agents[i].CreatorMemory; len(m.Weights) > 0 {
+					m.Weights = m.Weights[:len(m.Weights)-1]
+					return true
+				}
+			}
+			return false
+		}},
+		{"event evaluations", func(c *checkpoint) bool {
+			for i := range c.Events {
+				if e := &c.Events[i]; len(e.Evaluations) > 0 {
+					e.Evaluations = e.Evaluations[:len(e.Evaluations)-1]
+					return true
+				}
+			}
+			return false
+		}},
+		{"event rewards", func(c *checkpoint) bool {
+			for i := range c.Events {
+				if e := &c.Events[i]; len(e.Rewards) > 0 {
+					e.Rewards = nil
+					return true
+				}
+			}
+			return false
+		}},
+		{"summeries", func(c *checkpoint) bool {
+			c.Summeries = append(c.Summeries, make([]checkpoint_summery, c.NIter+1)...)
+			return true
+		}},
+	}
+
+	for _, test := range tests {
+		c := decode_checkpoint(t, data)
+		if !test.corrupt(c) {
+			t.Fatalf("%s: nothing to corrupt", test.name)
+		}
+		_, err := LoadCheckpoint(bytes.NewReader(encode_checkpoint(t, c)))
+		if _, ok := err.(*CheckpointLengthError); !ok {
+			t.Errorf("%s: got %v, want a CheckpointLengthError", test.name, err)
+		}
+	}
+}
+
+func decode_checkpoint(t *testing.T, data []byte) *checkpoint {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &checkpoint{}
+	if err := gob.NewDecoder(zr).Decode(c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func encode_checkpoint(t *testing.T, c *checkpoint) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	zw := gzip.NewWriter(&buffer)
+	if err := gob.NewEncoder(zw).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,271 @@
+package MuSL
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// シミュレーションの設定
+// コマンドライン引数や HTTP API の JSON から作り、Build でシミュレーションを作成する。
+// JSON で省略した項目は DefaultSimulationConfig の値になる。
+type SimulationConfig struct {
+	NumAgents        int     `json:"num_agents"`
+	NumIterations    int     `json:"num_iterations"`
+	Seed             int64   `json:"seed"` // 負なら Build でランダムに決める
+	MajorProbability float64 `json:"major_probability"`
+	MutationRate     float64 `json:"mutation_rate"`
+	MutationStrength float64 `json:"mutation_strength"`
+
+	// 記憶の容量と忘却方針 (作成者と聴取者で共通)
+	MemoryCapacity  int     `json:"memory_capacity"`
+	MemoryPolicy    string  `json:"memory_policy"`
+	MemoryDecayRate float64 `json:"memory_decay_rate"`
+	MemoryEvolvable bool    `json:"memory_evolvable"`
+
+	// エージェントの実行順序と並列実行 (parallel が true なら workers 個の goroutine で実行する)
+	Scheduler string `json:"scheduler"`
+	Parallel  bool   `json:"parallel"`
+	Workers   int    `json:"workers"`
+
+	// ジャンルのスナップショットの取り方
+	GenreEvery    int    `json:"genre_every"`
+	GenreAt       []int  `json:"genre_at"`
+	GenreSample   int    `json:"genre_sample"`
+	GenreEncoding string `json:"genre_encoding"`
+
+	DiversityGrid int `json:"diversity_grid"`
+}
+
+type ConfigError struct {
+	Name    string
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid " + e.Name + ": " + e.Message
+}
+
+func DefaultSimulationConfig() *SimulationConfig {
+	return &SimulationConfig{
+		NumAgents:        100,
+		NumIterations:    100,
+		Seed:             -1,
+		MajorProbability: 0.5,
+		MutationRate:     0.1,
+		MutationStrength: 0.05,
+		MemoryCapacity:   0,
+		MemoryPolicy:     ForgetNone,
+		MemoryDecayRate:  0.1,
+		MemoryEvolvable:  false,
+		Scheduler:        ScheduleFixed,
+		Parallel:         false,
+		Workers:          runtime.NumCPU(),
+		GenreEvery:       1,
+		GenreAt:          make([]int, 0),
+		GenreSample:      0,
+		GenreEncoding:    GenreRaw,
+		DiversityGrid:    10,
+	}
+}
+
+// JSON の設定を c に読み込む (JSON にない項目は c の値のまま)
+// 知らない項目があるとエラーになる。空の入力は何も変えない。
+func ReadSimulationConfig(r io.Reader, c *SimulationConfig) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// 設定の項目の名前 (JSON の名前)
+func ConfigFieldNames() []string {
+	t := reflect.TypeFor[SimulationConfig]()
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		names = append(names, csv_column_name(t.Field(i)))
+	}
+	return names
+}
+
+// JSON の名前で項目を 1 つ設定する (スイープなどで文字列から値を設定するため)
+// genre_at はカンマ区切りのイテレーションのリスト。
+func (c *SimulationConfig) Set(name, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := range v.NumField() {
+		if csv_column_name(v.Type().Field(i)) != name {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Int, reflect.Int64:
+			x, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return &ConfigError{name, "not an integer: " + strconv.Quote(value)}
+			}
+			field.SetInt(x)
+		case reflect.Float64:
+			x, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return &ConfigError{name, "not a number: " + strconv.Quote(value)}
+			}
+			field.SetFloat(x)
+		case reflect.Bool:
+			x, err := strconv.ParseBool(value)
+			if err != nil {
+				return &ConfigError{name, "not a boolean: " + strconv.Quote(value)}
+			}
+			field.SetBool(x)
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Slice:
+			list := make([]int, 0)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				x, err := strconv.Atoi(item)
+				if err != nil {
+					return &ConfigError{name, "not a list of integers: " + strconv.Quote(value)}
+				}
+				list = append(list, x)
+			}
+			field.Set(reflect.ValueOf(list))
+		}
+		return nil
+	}
+	return &ConfigError{name, "no such parameter (one of " + strings.Join(ConfigFieldNames(), ", ") + ")"}
+}
+
+// シミュレーションを作成せずに、設定の誤りを確かめる
+func (c *SimulationConfig) Validate() error {
+	if c.NumAgents < 0 {
+		return &ConfigError{"num_agents", "must not be negative"}
+	}
+	if c.NumIterations < 0 {
+		return &ConfigError{"num_iterations", "must not be negative"}
+	}
+	if c.MajorProbability < 0 || c.MajorProbability > 1 {
+		return &ConfigError{"major_probability", "must be between 0 and 1"}
+	}
+	if c.MutationRate < 0 || c.MutationRate > 1 {
+		return &ConfigError{"mutation_rate", "must be between 0 and 1"}
+	}
+	if c.MutationStrength < 0 {
+		return &ConfigError{"mutation_strength", "must not be negative"}
+	}
+	if c.DiversityGrid < 1 {
+		return &ConfigError{"diversity_grid", "must be at least 1, got " + strconv.Itoa(c.DiversityGrid)}
+	}
+
+	if _, err := MakeGenreSnapshotParams(c.GenreEvery, c.GenreAt, c.GenreSample, c.GenreEncoding); err != nil {
+		return err
+	}
+	if _, err := MakeMemoryParams(c.MemoryCapacity, c.MemoryPolicy, c.MemoryDecayRate, c.MemoryEvolvable); err != nil {
+		return err
+	}
+	if _, err := MakeScheduler(c.Scheduler); err != nil {
+		return err
+	}
+	// 同時に行動するのは synchronous だけなので、他の実行順序では並列に実行できない
+	if c.Parallel && c.Scheduler != ScheduleSynchronous {
+		return &ConfigError{"parallel", "requires the " + ScheduleSynchronous + " scheduler, got " + c.Scheduler}
+	}
+	return nil
+}
+
+// 設定からシミュレーションを作成する
+// Seed が負の場合はランダムに決めて c.Seed に書き戻す (再現できるように)。
+func (c *SimulationConfig) Build() (*Simulation, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	genre_snapshot, err := MakeGenreSnapshotParams(c.GenreEvery, c.GenreAt, c.GenreSample, c.GenreEncoding)
+	if err != nil {
+		return nil, err
+	}
+	memory_params, err := MakeMemoryParams(c.MemoryCapacity, c.MemoryPolicy, c.MemoryDecayRate, c.MemoryEvolvable)
+	if err != nil {
+		return nil, err
+	}
+	scheduler, err := MakeScheduler(c.Scheduler)
+	if err != nil {
+		return nil, err
+	}
+
+	ga_params := MakeGAParams(
+		c.MutationRate,     // mutation_rate
+		c.MutationStrength, // mutation_strength
+	)
+
+	// [*] = Experiment-specific
+	default_agent_params := MakeNewAgent(
+		-1,                       //     id
+		[]bool{true, true, true}, //     role
+		100.0,                    //     energy
+		100.0,                    // [*] default_energy
+		0.0,                      // [*] elimination_threshold
+		0.5,                      //     reproduction_probability
+
+		// creator
+		0.5,                              //     innovation_rate
+		MakeNewSongMemory(memory_params), // [*] memory
+		0.5,                              //     creation_probability
+		1.0,                              //     memory_retention
+		1.0,                              // [*] creation_cost
+
+		// listener
+		0.5,                                     //     novelty_preference
+		MakeNewIndexedSongMemory(memory_params), // [*] memory
+		make([]*Song, 0),                        //     incoming_songs
+		make([]*Event, 0),                       //     song_events
+		0.5,                                     //     listening_probability
+		1.0,                                     //     memory_retention
+		1.0,                                     // [*] evaluation_cost
+
+		// organizer
+		Const64(c.MajorProbability), // [*] major_probability
+		make([]*Event, 0),           //     created_events
+		0.5,                         //     event_probability
+		0.5,                         // [*] organization_cost
+		1.0,                         // [*] organization_reward
+
+		// イベント生成用のパラメータ
+		// メジャーイベント
+		0.5, // [*] major_listener_ratio
+		0.5, // [*] major_creator_ratio
+		0.1, // [*] major_song_ratio
+		0.5, // [*] major_winner_ratio
+		0.5, // [*] major_reward_ratio
+		0.1, // [*] major_recommendation_ratio
+
+		// マイナーイベント
+		0.1, // [*] minor_listener_ratio
+		0.1, // [*] minor_creator_ratio
+		0.5, // [*] minor_song_ratio
+		0.5, // [*] minor_reward_ratio
+		0.1, // [*] minor_recommendation_ratio
+	)
+
+	// シード値が負ならランダムに決める
+	if c.Seed < 0 {
+		c.Seed = rand.Int64()
+	}
+
+	sim := MakeNewSimulation(c.NumAgents, c.NumIterations, uint64(c.Seed), ga_params, default_agent_params)
+	sim.SetScheduler(scheduler)
+	if c.Parallel {
+		sim.SetParallel(c.Workers)
+	}
+	sim.SetGenreSnapshot(genre_snapshot)
+	sim.SetDiversityGrid(c.DiversityGrid)
+	return sim, nil
+}
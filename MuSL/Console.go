@@ -0,0 +1,361 @@
+package MuSL
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 実行中のシミュレーションを 1 行ずつのコマンドで操作する対話モード
+// 集団の急減など、気になるところで止めて中を見るために使う。
+type Console struct {
+	sim     *Simulation
+	scanner *bufio.Scanner
+	w       io.Writer
+}
+
+const console_help = `commands:
+  step [N]                 N iterations (default 1)
+  run-until <cond>         step until <cond> holds, e.g. population<10, num_song_now>=500
+  run                      step to the last iteration
+  agent <id>               state of an agent
+  events                   events waiting to be settled
+  songs near <x>,<y> [K]   K living songs nearest to the genre (default 10)
+  set <name> <value>       change a parameter (see "set")
+  summary                  scalar values of the latest summery
+  help                     this message
+  quit                     stop the console and write the outputs`
+
+// run-until で使える短い名前
+var console_aliases = map[string]string{
+	"population": "num_population",
+	"creators":   "num_creaters",
+	"listeners":  "num_listeners",
+	"organizers": "num_organizers",
+	"songs":      "num_song_now",
+	"events":     "num_event_this",
+	"energy":     "total_energy",
+}
+
+var console_condition = regexp.MustCompile(`^([A-Za-z_]+)(<=|>=|==|!=|<|>)(.+)$`)
+
+// set で変えられるパラメータ
+var console_parameters = map[string]func(s *Simulation, value string) error{
+	// 運営者がメジャーイベントを開く確率 (生きているエージェントと、これから生まれるエージェント)
+	"major_probability": func(s *Simulation, value string) error {
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil || p < 0 || p > 1 {
+			return errors.New("major_probability must be between 0 and 1")
+		}
+		s.default_agent_params.organizer.major_probability = Const64(p)
+		for _, agent := range s.agents {
+			agent.organizer.major_probability = Const64(p)
+		}
+		return nil
+	},
+	"mutation_rate": func(s *Simulation, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return errors.New("mutation_rate must be between 0 and 1")
+		}
+		s.ga_params.mutation_rate = rate
+		return nil
+	},
+	"mutation_strength": func(s *Simulation, value string) error {
+		strength, err := strconv.ParseFloat(value, 64)
+		if err != nil || strength < 0 {
+			return errors.New("mutation_strength must not be negative")
+		}
+		s.ga_params.mutation_strength = strength
+		return nil
+	},
+	"diversity_grid": func(s *Simulation, value string) error {
+		grid, err := strconv.Atoi(value)
+		if err != nil || grid < 1 {
+			return errors.New("diversity_grid must be at least 1")
+		}
+		s.SetDiversityGrid(grid)
+		return nil
+	},
+	"num_iterations": func(s *Simulation, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("num_iterations must be an integer")
+		}
+		return s.SetNumIterations(n)
+	},
+}
+
+func MakeConsole(sim *Simulation, r io.Reader, w io.Writer) *Console {
+	return &Console{
+		sim:     sim,
+		scanner: bufio.NewScanner(r),
+		w:       w,
+	}
+}
+
+// quit か入力の終わりまでコマンドを実行する
+// コマンドの誤りは表示して続ける。シミュレーションを進める途中のエラー (チェックポイントの保存) は返す。
+func (c *Console) Run() error {
+	fmt.Fprintln(c.w, `type "help" for commands`)
+	c.print_status()
+	for {
+		fmt.Fprint(c.w, "(musl) ")
+		if !c.scanner.Scan() {
+			fmt.Fprintln(c.w)
+			return c.scanner.Err()
+		}
+
+		quit, err := c.Execute(c.scanner.Text())
+		if err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// 1 行のコマンドを実行する。quit なら true を返す。
+func (c *Console) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	var err error
+	switch command, args := fields[0], fields[1:]; command {
+	case "step":
+		n := 1
+		if len(args) > 0 {
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+				c.print_error(errors.New("usage: step [N]"))
+				return false, nil
+			}
+		}
+		return false, c.step(n, nil)
+	case "run":
+		return false, c.step(c.sim.n_iter-c.sim.iteration, nil)
+	case "run-until":
+		condition, err := parse_console_condition(strings.Join(args, ""))
+		if err != nil {
+			c.print_error(err)
+			return false, nil
+		}
+		return false, c.step(c.sim.n_iter-c.sim.iteration, condition)
+	case "agent":
+		err = c.agent(args)
+	case "events":
+		c.events()
+	case "songs":
+		err = c.songs_near(args)
+	case "set":
+		err = c.set(args)
+	case "summary":
+		c.summary()
+	case "help":
+		fmt.Fprintln(c.w, console_help)
+	case "quit", "exit":
+		return true, nil
+	default:
+		err = errors.New("unknown command: " + strconv.Quote(command) + ` (type "help")`)
+	}
+	if err != nil {
+		c.print_error(err)
+	}
+	return false, nil
+}
+
+// 最大 n イテレーション進める。condition があれば、成り立ったところで止める。
+func (c *Console) step(n int, condition func(*PublicSummery) bool) error {
+	for range n {
+		if c.sim.iteration >= c.sim.n_iter {
+			fmt.Fprintln(c.w, "reached the last iteration (set num_iterations to go further)")
+			break
+		}
+		if _, err := c.sim.Advance(1); err != nil {
+			return err
+		}
+		if condition != nil && condition(c.sim.summery[c.sim.iteration].Publish()) {
+			fmt.Fprintln(c.w, "condition holds")
+			break
+		}
+	}
+	c.print_status()
+	return nil
+}
+
+// "population<10" のような条件を、最新のサマリーについての判定にする
+func parse_console_condition(text string) (func(*PublicSummery) bool, error) {
+	match := console_condition.FindStringSubmatch(text)
+	if match == nil {
+		return nil, errors.New("usage: run-until <name><op><value>, e.g. population<10")
+	}
+	name, op := match[1], match[2]
+	if alias, ok := console_aliases[name]; ok {
+		name = alias
+	}
+	value, err := strconv.ParseFloat(match[3], 64)
+	if err != nil {
+		return nil, errors.New("invalid value: " + strconv.Quote(match[3]))
+	}
+
+	// PublicSummery の数値の項目を json の名前で探す
+	index := numeric_field_index(name)
+	if index < 0 {
+		return nil, errors.New("unknown summery value: " + strconv.Quote(name))
+	}
+
+	return func(summery *PublicSummery) bool {
+		x := numeric_value(reflect.ValueOf(summery).Elem().Field(index))
+		switch op {
+		case "<":
+			return x < value
+		case "<=":
+			return x <= value
+		case ">":
+			return x > value
+		case ">=":
+			return x >= value
+		case "==":
+			return x == value
+		default:
+			return x != value
+		}
+	}, nil
+}
+
+func (c *Console) agent(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: agent <id>")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errors.New("invalid agent id: " + strconv.Quote(args[0]))
+	}
+
+	for _, agent := range c.sim.agents {
+		if agent.id == id {
+			data, _ := json.MarshalIndent(make_agent_info(agent), "", "  ")
+			fmt.Fprintln(c.w, string(data))
+			if agent.energy <= 0 {
+				fmt.Fprintln(c.w, "(dead: removed at the next iteration)")
+			}
+			return nil
+		}
+	}
+	return errors.New("agent not found: " + strconv.Itoa(id))
+}
+
+// 開催されて、次のイテレーションの精算を待っているイベント
+func (c *Console) events() {
+	fmt.Fprintf(c.w, "%8s %6s %10s %9s %6s %9s %11s %15s\n",
+		"id", "type", "organizer", "iteration", "songs", "listeners", "evaluations", "recommendations")
+	count := 0
+	for _, agent := range c.sim.agents {
+		if agent.energy <= 0 {
+			continue
+		}
+		for _, event := range agent.organizer.created_events {
+			evaluations := 0
+			for _, list := range event.evaluation_pool {
+				evaluations += len(list)
+			}
+			fmt.Fprintf(c.w, "%8d %6s %10d %9d %6d %9d %11d %15d\n",
+				event.id, event.event_type, event.organizer_id, event.iteration,
+				len(event.creator_pool), len(event.listener_pool), evaluations, event.num_recommendations)
+			count++
+		}
+	}
+	fmt.Fprintln(c.w, count, "events")
+}
+
+// songs near x,y [K]
+func (c *Console) songs_near(args []string) error {
+	if len(args) < 2 || len(args) > 3 || args[0] != "near" {
+		return errors.New("usage: songs near <x>,<y> [K]")
+	}
+	genre := make([]float64, 0, 2)
+	for _, field := range strings.Split(args[1], ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return errors.New("invalid genre: " + strconv.Quote(args[1]))
+		}
+		genre = append(genre, value)
+	}
+	k := 10
+	if len(args) == 3 {
+		var err error
+		if k, err = strconv.Atoi(args[2]); err != nil || k < 1 {
+			return errors.New("K must be a positive integer")
+		}
+	}
+
+	// 生きている作成者の memory にある曲から探す
+	tree := MakeNewKDTree()
+	for _, agent := range c.sim.agents {
+		if agent.energy <= 0 {
+			continue
+		}
+		for _, song := range agent.creator.memory.Songs() {
+			if len(song.genre) != len(genre) {
+				return errors.New("genre must have " + strconv.Itoa(len(song.genre)) + " dimensions")
+			}
+			tree.Insert(song)
+		}
+	}
+
+	fmt.Fprintf(c.w, "%8s %8s %8s %9s %10s  %s\n", "id", "parent", "creator", "iteration", "distance", "genre")
+	for _, neighbor := range tree.KNearest(genre, k) {
+		song := neighbor.Song
+		fmt.Fprintf(c.w, "%8d %8d %8d %9d %10.6f  %v\n",
+			song.id, song.parent_id, song.creator_id, song.iteration, neighbor.Distance, song.genre)
+	}
+	return nil
+}
+
+func (c *Console) set(args []string) error {
+	names := make([]string, 0, len(console_parameters))
+	for name := range console_parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(args) != 2 {
+		return errors.New("usage: set <name> <value>, name is one of " + strings.Join(names, ", "))
+	}
+	setter, ok := console_parameters[args[0]]
+	if !ok {
+		return errors.New("unknown parameter: " + strconv.Quote(args[0]) + ", name is one of " + strings.Join(names, ", "))
+	}
+	if err := setter(c.sim, args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.w, args[0], "=", args[1])
+	return nil
+}
+
+// 最新のサマリーの数値の項目
+func (c *Console) summary() {
+	v := reflect.ValueOf(c.sim.summery[c.sim.iteration].Publish()).Elem()
+	for _, name := range NumericSummeryFields() {
+		fmt.Fprintf(c.w, "%-26s %s\n", name, format_scalar(v.Field(numeric_field_index(name))))
+	}
+}
+
+func (c *Console) print_status() {
+	summery := c.sim.summery[c.sim.iteration]
+	fmt.Fprintf(c.w, "iteration %d/%d: agents %d, songs %d, events %d, energy %.1f\n",
+		c.sim.iteration, c.sim.n_iter, len(c.sim.agents), summery.num_song_now, summery.num_event_this, summery.total_energy)
+}
+
+func (c *Console) print_error(err error) {
+	fmt.Fprintln(c.w, "error:", err)
+}
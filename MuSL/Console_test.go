@@ -0,0 +1,217 @@
+package MuSL
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func test_console(t *testing.T) (*Console, *Simulation, *bytes.Buffer) {
+	t.Helper()
+	sim, err := test_config(ScheduleFixed, 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	var out bytes.Buffer
+	return MakeConsole(sim, strings.NewReader(""), &out), sim, &out
+}
+
+// コマンドを実行し、出力を返す。コマンドの誤りで止まってはいけない。
+func execute(t *testing.T, c *Console, out *bytes.Buffer, line string) string {
+	t.Helper()
+	out.Reset()
+	quit, err := c.Execute(line)
+	if err != nil {
+		t.Fatalf("%q: %v", line, err)
+	}
+	if quit {
+		t.Fatalf("%q: the console quit", line)
+	}
+	return out.String()
+}
+
+func TestConsoleCommands(t *testing.T) {
+	c, sim, out := test_console(t)
+
+	tests := []struct {
+		line      string
+		output    string // 出力に含まれる文字列
+		failed    bool   // エラーが表示される
+		iteration int    // 実行後のイテレーション
+	}{
+		{"", "", false, 0},
+		{"step", "iteration 1/30", false, 1},
+		{"step 3", "iteration 4/30", false, 4},
+		{"step -1", "usage: step [N]", true, 4},
+		{"step x", "usage: step [N]", true, 4},
+		{"dance", "unknown command", true, 4},
+		{"run-until population", "usage: run-until", true, 4},
+		{"run-until nothing<3", "unknown summery value", true, 4},
+		{"run-until population<ten", "invalid value", true, 4},
+		{"agent", "usage: agent <id>", true, 4},
+		{"agent -5", "agent not found", true, 4},
+		{"set", "usage: set", true, 4},
+		{"set gravity 9.8", "unknown parameter", true, 4},
+		{"set mutation_rate 2", "mutation_rate must be between 0 and 1", true, 4},
+		{"songs", "usage: songs near", true, 4},
+		{"songs near 0.5,x", "invalid genre", true, 4},
+		{"songs near 0.5,0.5 0", "K must be a positive integer", true, 4},
+		{"songs near 0.5,0.5,0.5", "genre must have 2 dimensions", true, 4},
+		{"songs near 0.5", "genre must have 2 dimensions", true, 4},
+		{"songs near 0.5,0.5 3", "distance", false, 4},
+		{"summary", "num_population", false, 4},
+		{"events", "events", false, 4},
+		{"help", "run-until <cond>", false, 4},
+	}
+
+	for _, test := range tests {
+		output := execute(t, c, out, test.line)
+		if !strings.Contains(output, test.output) {
+			t.Errorf("%q: output %q does not contain %q", test.line, output, test.output)
+		}
+		if has_error := strings.Contains(output, "error:"); has_error != test.failed {
+			t.Errorf("%q: error shown %v, want %v: %q", test.line, has_error, test.failed, output)
+		}
+		if sim.iteration != test.iteration {
+			t.Errorf("%q: iteration %d, want %d", test.line, sim.iteration, test.iteration)
+		}
+	}
+
+	if quit, err := c.Execute("quit"); !quit || err != nil {
+		t.Errorf("quit: got %v, %v", quit, err)
+	}
+}
+
+// songs near は K 曲を近い順に表示する
+func TestConsoleSongsNear(t *testing.T) {
+	c, _, out := test_console(t)
+	execute(t, c, out, "step 3")
+
+	output := execute(t, c, out, "songs near 0.5,0.5 3")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("%d lines, want a header and 3 songs:\n%s", len(lines), output)
+	}
+}
+
+// run-until は条件が成り立ったイテレーションで止まる
+func TestConsoleRunUntil(t *testing.T) {
+	reference, err := test_config(ScheduleFixed, 1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference.SetVerbose(false)
+	if err := reference.Run(); err != nil {
+		t.Fatal(err)
+	}
+	first := func(from int, holds func(population int) bool) int {
+		for _, summery := range reference.GetSummery()[from+1:] {
+			if holds(summery.NumPopulation) {
+				return summery.Iteration
+			}
+		}
+		return reference.n_iter
+	}
+
+	c, sim, out := test_console(t)
+
+	// 集団が増えてから減るところで止まる
+	peak := 0
+	for _, summery := range reference.GetSummery() {
+		peak = max(peak, summery.NumPopulation)
+	}
+	grown := first(0, func(p int) bool { return p >= peak })
+	declined := first(grown, func(p int) bool { return p < peak-2 })
+	if declined >= reference.n_iter {
+		t.Fatalf("population never declined below %d", peak-2)
+	}
+
+	output := execute(t, c, out, "run-until population>="+strconv.Itoa(peak))
+	if sim.iteration != grown || !strings.Contains(output, "condition holds") {
+		t.Errorf("population>=%d: stopped at %d, want %d: %q", peak, sim.iteration, grown, output)
+	}
+	output = execute(t, c, out, "run-until population < "+strconv.Itoa(peak-2))
+	if sim.iteration != declined || !strings.Contains(output, "condition holds") {
+		t.Errorf("population<%d: stopped at %d, want %d: %q", peak-2, sim.iteration, declined, output)
+	}
+
+	// 成り立たなければ最後まで進める
+	output = execute(t, c, out, "run-until population<0")
+	if sim.iteration != sim.n_iter || strings.Contains(output, "condition holds") {
+		t.Errorf("population<0: stopped at %d: %q", sim.iteration, output)
+	}
+	output = execute(t, c, out, "step")
+	if !strings.Contains(output, "reached the last iteration") {
+		t.Errorf("step after the last iteration: %q", output)
+	}
+}
+
+// set major_probability は生きているエージェントとこれから生まれるエージェントの両方を変える
+func TestConsoleSetMajorProbability(t *testing.T) {
+	c, sim, out := test_console(t)
+	execute(t, c, out, "step 2")
+
+	output := execute(t, c, out, "set major_probability 0.25")
+	if !strings.Contains(output, "major_probability = 0.25") {
+		t.Errorf("output %q", output)
+	}
+	check := func(want float64) {
+		t.Helper()
+		if got := float64(sim.default_agent_params.organizer.major_probability); got != want {
+			t.Errorf("default major_probability %v, want %v", got, want)
+		}
+		for _, agent := range sim.agents {
+			if got := float64(agent.organizer.major_probability); got != want {
+				t.Errorf("agent %d: major_probability %v, want %v", agent.id, got, want)
+				return
+			}
+		}
+	}
+	check(0.25)
+
+	for _, value := range []string{"1.5", "-0.1", "often"} {
+		output := execute(t, c, out, "set major_probability "+value)
+		if !strings.Contains(output, "error:") {
+			t.Errorf("set major_probability %s: no error: %q", value, output)
+		}
+		check(0.25)
+	}
+
+	// 生まれてくるエージェントも既定値を引き継ぐ
+	execute(t, c, out, "step 5")
+	check(0.25)
+}
+
+// num_iterations は現在のイテレーションより小さくできない
+func TestConsoleSetNumIterations(t *testing.T) {
+	c, sim, out := test_console(t)
+	execute(t, c, out, "step 5")
+
+	tests := []struct {
+		value  string
+		failed bool
+		n_iter int
+	}{
+		{"3", true, 30},
+		{"4", true, 30},
+		{"ten", true, 30},
+		{"5", false, 5},
+		{"40", false, 40},
+	}
+	for _, test := range tests {
+		output := execute(t, c, out, "set num_iterations "+test.value)
+		if has_error := strings.Contains(output, "error:"); has_error != test.failed {
+			t.Errorf("set num_iterations %s: error shown %v, want %v: %q", test.value, has_error, test.failed, output)
+		}
+		if sim.n_iter != test.n_iter {
+			t.Errorf("set num_iterations %s: n_iter %d, want %d", test.value, sim.n_iter, test.n_iter)
+		}
+	}
+
+	execute(t, c, out, "run")
+	if sim.iteration != 40 || len(sim.GetSummery()) != 41 {
+		t.Errorf("run: iteration %d, %d summeries", sim.iteration, len(sim.GetSummery()))
+	}
+}
@@ -2,40 +2,66 @@ package MuSL
 
 import (
 	"math"
-	"math/rand"
+	"sync/atomic"
 )
 
-// Readonly
+// 曲の ID を管理するためのグローバル変数
+var global_song_id_counter atomic.Int64
+
+func GetNewSongID() int {
+	return int(global_song_id_counter.Add(1))
+}
+
+// Readonly (extinct_iteration と stats を除く)
 type Song struct {
-	genre   []float64
-	creator *Agent
+	id                int
+	parent_id         int // 派生元の曲の ID (ランダムに生成した場合は -1)
+	iteration         int // 作成されたイテレーション
+	extinct_iteration int // 作成者の memory から失われたイテレーション (残っている場合は -1)
+	genre             []float64
+	creator           *Agent
+	creator_id        int
+	stats             SongStats // イベントを通じて更新される集計値
+}
+
+// 曲ごとの人気の集計値
+type SongStats struct {
+	num_events        int     // 参加したイベントの数
+	num_evaluations   int     // 受けた評価の数
+	sum_evaluation    float64 // 評価の合計
+	sum_sq_evaluation float64 // 評価の二乗和
+	total_reward      float64 // 作成者に支払われた報酬の合計
+	won_major         bool    // メジャーイベントで上位に入ったことがあるか
 }
 
 type Creator struct {
 	innovation_rate      float64
-	memory               []*Song
+	memory               *SongMemory
 	creation_probability float64
+	memory_retention     float64 // 記憶容量の遺伝子 (MemoryParams.evolvable のときのみ有効)
 	creation_cost        Const64
 }
 
-func (c *Creator) Create(agents *[]*Agent, me *Agent, summery *Summery) {
-	if rand.Float64() < c.creation_probability {
+func (c *Creator) Create(agents *[]*Agent, me *Agent, summery *Summery, effects *Effects) {
+	if me.rng.Float64() < c.creation_probability {
 		// 曲を生成
 		genre := make([]float64, 2)
+		parent_id := -1
 
 		// innovation rate に従ってジャンルを生成
 		// memory からランダムに選んで突然変異
 
 		// memory が空の場合はランダムに生成
-		if len(c.memory) == 0 {
+		parent := c.memory.Sample(me.rng)
+		if parent == nil {
 			for i := 0; i < len(genre); i++ {
-				genre[i] = rand.Float64()
+				genre[i] = me.rng.Float64()
 			}
 		} else {
-			random_index := rand.Intn(len(c.memory))
+			parent_id = parent.id
 			for i := 0; i < len(genre); i++ {
-				genre[i] = c.memory[random_index].genre[i] +
-					(rand.Float64()*2.0-1.0)*c.innovation_rate
+				genre[i] = parent.genre[i] +
+					(me.rng.Float64()*2.0-1.0)*c.innovation_rate
 
 				// 0 以上 1 未満に収める
 				genre[i] = math.Max(0.0, math.Min(1.0, genre[i]))
@@ -43,17 +69,31 @@ func (c *Creator) Create(agents *[]*Agent, me *Agent, summery *Summery) {
 		}
 
 		// 曲を生成して memory に追加
+		// ID は effects.NewSong で振る
 		song := &Song{
-			genre:   genre,
-			creator: me,
+			id:                0,
+			parent_id:         parent_id,
+			iteration:         summery.iteration,
+			extinct_iteration: -1,
+			genre:             genre,
+			creator:           me,
+			creator_id:        me.id,
+		}
+
+		effects.NewSong(song)
+
+		// memory から溢れた曲は失われる
+		for _, forgotten := range c.memory.Add(song, math.NaN(), c.memory_retention, me.rng) {
+			forgotten.extinct_iteration = summery.iteration
 		}
-		c.memory = append(c.memory, song)
 
 		// エネルギーを消費
 		me.energy -= float64(c.creation_cost)
+		me.income.CreationCost += float64(c.creation_cost)
 
 		// 集計 (I)
 		summery.num_song_all++
 		summery.num_song_this++
+		summery.new_songs = append(summery.new_songs, song)
 	}
 }
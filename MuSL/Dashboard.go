@@ -0,0 +1,315 @@
+package MuSL
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// シミュレーションの途中経過を HTTP で見せる SimulationObserver
+// 通知はシミュレーションの goroutine から、HTTP のリクエストは別の goroutine から来るので、mu で守る。
+//
+//	GET /                       自動で更新されるダッシュボード (HTML)
+//	GET /api/latest             最新の PublicSummery
+//	GET /api/history?since=N    イテレーションが N より後の PublicSummery のリスト (ジャンルを除く)
+//	GET /api/genres             最新のジャンルのスナップショット
+//	GET /api/status             最新のイテレーションと、シミュレーションが終わったかどうか
+type Dashboard struct {
+	NopObserver
+
+	mu       sync.RWMutex
+	latest   *PublicSummery
+	history  []*PublicSummery // ジャンルを除いたもの (イテレーション順)
+	genres   *DashboardGenres
+	finished bool
+
+	mux *http.ServeMux
+}
+
+// ジャンルのスナップショット
+type DashboardGenres struct {
+	Iteration int         `json:"iteration"`
+	Genres    [][]float64 `json:"genres"`
+}
+
+// ダッシュボードの状態
+type DashboardStatus struct {
+	Iteration int  `json:"iteration"`
+	Finished  bool `json:"finished"`
+}
+
+func MakeDashboard() *Dashboard {
+	d := &Dashboard{
+		history: make([]*PublicSummery, 0),
+		genres:  &DashboardGenres{Iteration: -1, Genres: make([][]float64, 0)},
+		mux:     http.NewServeMux(),
+	}
+	d.mux.HandleFunc("GET /{$}", d.serve_page)
+	d.mux.HandleFunc("GET /api/latest", d.serve_latest)
+	d.mux.HandleFunc("GET /api/history", d.serve_history)
+	d.mux.HandleFunc("GET /api/genres", d.serve_genres)
+	d.mux.HandleFunc("GET /api/status", d.serve_status)
+	return d
+}
+
+// それまでのサマリーを読み込む (チェックポイントから再開した場合など)
+func (d *Dashboard) Load(summeries []*PublicSummery) {
+	for _, summery := range summeries {
+		d.OnIterationEnd(summery)
+	}
+}
+
+// シミュレーションが終わったことを記録する
+func (d *Dashboard) Finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.finished = true
+}
+
+func (d *Dashboard) OnIterationEnd(summery *PublicSummery) {
+	// 履歴にはジャンルを持たせない
+	entry := *summery
+	entry.AllGenres = nil
+	entry.GenresCompact = ""
+
+	// 壊れたスナップショットは表示しない
+	genres, _ := summery.Genres()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// 同じイテレーションが再び通知された場合は、それ以降を置き換える
+	for len(d.history) > 0 && d.history[len(d.history)-1].Iteration >= summery.Iteration {
+		d.history = d.history[:len(d.history)-1]
+	}
+	d.history = append(d.history, &entry)
+	d.latest = summery
+	if len(genres) > 0 {
+		d.genres = &DashboardGenres{Iteration: summery.Iteration, Genres: genres}
+	}
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+func (d *Dashboard) serve_page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(dashboard_page))
+}
+
+func (d *Dashboard) serve_latest(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	latest := d.latest
+	d.mu.RUnlock()
+
+	if latest == nil {
+		http.Error(w, "no summery yet", http.StatusNotFound)
+		return
+	}
+	write_dashboard_json(w, latest)
+}
+
+func (d *Dashboard) serve_history(w http.ResponseWriter, r *http.Request) {
+	since := -1
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "invalid since: "+strconv.Quote(value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	d.mu.RLock()
+	entries := make([]*PublicSummery, 0)
+	for _, entry := range d.history {
+		if entry.Iteration > since {
+			entries = append(entries, entry)
+		}
+	}
+	d.mu.RUnlock()
+
+	write_dashboard_json(w, entries)
+}
+
+func (d *Dashboard) serve_genres(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	genres := d.genres
+	d.mu.RUnlock()
+
+	write_dashboard_json(w, genres)
+}
+
+func (d *Dashboard) serve_status(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	status := DashboardStatus{Iteration: -1, Finished: d.finished}
+	if d.latest != nil {
+		status.Iteration = d.latest.Iteration
+	}
+	d.mu.RUnlock()
+
+	write_dashboard_json(w, status)
+}
+
+func write_dashboard_json(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(value)
+}
+
+// 色は Plot.go のグラフと揃える
+var dashboard_page = strings.NewReplacer(
+	"$COLOR_TOTAL", ColorTotal,
+	"$COLOR_CREATOR", ColorCreator,
+	"$COLOR_LISTENER", ColorListener,
+	"$COLOR_ORGANIZER", ColorOrganizer,
+	"$COLOR_SONG", ColorSong,
+).Replace(dashboard_html)
+
+const dashboard_html = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MuSL dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 16px; background: #fafafa; color: #222; }
+h1 { font-size: 20px; margin: 0 0 4px; }
+#status { margin-bottom: 12px; color: #555; }
+.charts { display: flex; flex-wrap: wrap; gap: 16px; }
+.chart { background: white; border: 1px solid #ddd; padding: 8px; }
+.chart h2 { font-size: 14px; margin: 0 0 4px; }
+.legend span { margin-right: 12px; font-size: 12px; }
+.legend i { display: inline-block; width: 14px; height: 3px; vertical-align: middle; margin-right: 4px; }
+</style>
+</head>
+<body>
+<h1>MuSL dashboard</h1>
+<div id="status">waiting for the simulation...</div>
+<div class="charts">
+  <div class="chart"><h2>Population by role</h2><canvas id="population" width="480" height="300"></canvas><div class="legend" id="population_legend"></div></div>
+  <div class="chart"><h2>Energy by role</h2><canvas id="energy" width="480" height="300"></canvas><div class="legend" id="energy_legend"></div></div>
+  <div class="chart"><h2 id="genres_title">Genres</h2><canvas id="genres" width="300" height="300"></canvas></div>
+</div>
+<script>
+const ROLES = [
+  ["all", "$COLOR_TOTAL"],
+  ["creators", "$COLOR_CREATOR"],
+  ["listeners", "$COLOR_LISTENER"],
+  ["organizers", "$COLOR_ORGANIZER"],
+];
+const POPULATION = [s => s.num_population, s => s.num_creaters, s => s.num_listeners, s => s.num_organizers];
+const ENERGY = [s => s.total_energy, s => s.energy_creators, s => s.energy_listeners, s => s.energy_organizers];
+const history = [];
+let last = -1;
+
+function legend(id) {
+  document.getElementById(id).innerHTML = ROLES.map(([name, color]) =>
+    '<span><i style="background:' + color + '"></i>' + name + '</span>').join("");
+}
+
+function niceStep(range) {
+  const raw = range / 5;
+  const magnitude = Math.pow(10, Math.floor(Math.log10(raw)));
+  for (const m of [1, 2, 5]) {
+    if (raw <= m * magnitude) return m * magnitude;
+  }
+  return 10 * magnitude;
+}
+
+function lineChart(id, values) {
+  const canvas = document.getElementById(id);
+  const ctx = canvas.getContext("2d");
+  const left = 56, right = 10, top = 10, bottom = 24;
+  const width = canvas.width - left - right, height = canvas.height - top - bottom;
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  if (history.length === 0) return;
+
+  const x_min = history[0].iteration, x_max = Math.max(history[history.length - 1].iteration, x_min + 1);
+  let y_max = 0;
+  for (const value of values) for (const s of history) y_max = Math.max(y_max, value(s));
+  const y_step = niceStep(y_max > 0 ? y_max : 1);
+  y_max = Math.ceil((y_max > 0 ? y_max : 1) / y_step) * y_step;
+  const px = x => left + (x - x_min) / (x_max - x_min) * width;
+  const py = y => top + height - y / y_max * height;
+
+  ctx.font = "11px sans-serif";
+  ctx.strokeStyle = "#e0e0e0";
+  ctx.fillStyle = "#444";
+  ctx.textAlign = "right";
+  ctx.textBaseline = "middle";
+  for (let y = 0; y <= y_max + y_step / 2; y += y_step) {
+    ctx.beginPath(); ctx.moveTo(left, py(y)); ctx.lineTo(left + width, py(y)); ctx.stroke();
+    ctx.fillText(+y.toPrecision(6), left - 4, py(y));
+  }
+  ctx.textAlign = "center";
+  ctx.textBaseline = "top";
+  const x_step = Math.max(1, niceStep(x_max - x_min));
+  for (let x = Math.ceil(x_min / x_step) * x_step; x <= x_max; x += x_step) {
+    ctx.fillText(x, px(x), top + height + 4);
+  }
+  ctx.strokeStyle = "black";
+  ctx.strokeRect(left, top, width, height);
+
+  values.forEach((value, i) => {
+    ctx.strokeStyle = ROLES[i][1];
+    ctx.lineWidth = 1.5;
+    ctx.beginPath();
+    history.forEach((s, k) => k === 0 ? ctx.moveTo(px(s.iteration), py(value(s))) : ctx.lineTo(px(s.iteration), py(value(s))));
+    ctx.stroke();
+    ctx.lineWidth = 1;
+  });
+}
+
+function scatter(snapshot) {
+  const canvas = document.getElementById("genres");
+  const ctx = canvas.getContext("2d");
+  const size = canvas.width - 20;
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  ctx.strokeStyle = "black";
+  ctx.strokeRect(10, 10, size, size);
+  ctx.fillStyle = "$COLOR_SONG";
+  ctx.globalAlpha = 0.6;
+  for (const genre of snapshot.genres) {
+    ctx.fillRect(10 + genre[0] * size - 1.5, 10 + (1 - genre[1]) * size - 1.5, 3, 3);
+  }
+  ctx.globalAlpha = 1;
+  document.getElementById("genres_title").textContent = snapshot.iteration < 0
+    ? "Genres" : "Genres at iteration " + snapshot.iteration + " (" + snapshot.genres.length + " songs)";
+}
+
+async function refresh() {
+  try {
+    // 終わったことを先に確かめてから履歴を読めば、最後のイテレーションを取りこぼさない
+    const status = await (await fetch("api/status")).json();
+    const entries = await (await fetch("api/history?since=" + last)).json();
+    for (const entry of entries) {
+      // 再開などで巻き戻った場合
+      while (history.length > 0 && history[history.length - 1].iteration >= entry.iteration) history.pop();
+      history.push(entry);
+    }
+    if (history.length > 0) last = history[history.length - 1].iteration;
+
+    const latest = history[history.length - 1];
+    document.getElementById("status").textContent = status.iteration < 0 ? "waiting for the simulation..."
+      : "iteration " + status.iteration + ", agents " + latest.num_population + ", songs " + latest.num_song_now
+        + (status.finished ? " (finished)" : " (running)");
+
+    lineChart("population", POPULATION);
+    lineChart("energy", ENERGY);
+    if (entries.length > 0) scatter(await (await fetch("api/genres")).json());
+    if (status.finished) return;
+  } catch (e) {
+    document.getElementById("status").textContent = "disconnected: " + e;
+  }
+  setTimeout(refresh, 1000);
+}
+
+legend("population_legend");
+legend("energy_legend");
+refresh();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,153 @@
+package MuSL
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sort"
+)
+
+// ジャンルの多様性の指標
+type Diversity struct {
+	Entropy      float64 // 格子で区切ったセルごとの曲数の Shannon エントロピー (bit)
+	Richness     int     // 曲が 1 曲以上あるセルの数
+	MeanDistance float64 // 全ての曲の組のユークリッド距離の平均
+	HullArea     float64 // 凸包の面積。ジャンルが 2 次元でない場合は計算せず NaN とする。
+}
+
+// genres の多様性を計算する。ジャンル空間の各軸を grid 等分したセルを用いる。
+func GenreDiversity(genres [][]float64, grid int) Diversity {
+	return Diversity{
+		Entropy:      grid_entropy(genres, grid),
+		Richness:     grid_richness(genres, grid),
+		MeanDistance: mean_pairwise_distance(genres),
+		HullArea:     convex_hull_area(genres),
+	}
+}
+
+// 生きている作成者の memory にある曲と、このイテレーションで作成された曲の多様性を計算する (7)
+func (s *Summery) CalculateDiversity(agents []*Agent, grid int) {
+	genres := make([][]float64, 0)
+	for _, agent := range agents {
+		// 生きているエージェントのみ
+		if agent.energy <= 0 {
+			continue
+		}
+		for _, song := range agent.creator.memory.Songs() {
+			genres = append(genres, song.genre)
+		}
+	}
+	diversity := GenreDiversity(genres, grid)
+	s.genre_entropy = diversity.Entropy            // 7-1
+	s.genre_richness = diversity.Richness          // 7-2
+	s.genre_mean_distance = diversity.MeanDistance // 7-3
+	s.genre_hull_area = diversity.HullArea         // 7-4
+
+	new_genres := make([][]float64, len(s.new_songs))
+	for i, song := range s.new_songs {
+		new_genres[i] = song.genre
+	}
+	new_diversity := GenreDiversity(new_genres, grid)
+	s.new_genre_entropy = new_diversity.Entropy            // 7-5
+	s.new_genre_richness = new_diversity.Richness          // 7-6
+	s.new_genre_mean_distance = new_diversity.MeanDistance // 7-7
+	s.new_genre_hull_area = new_diversity.HullArea         // 7-8
+}
+
+// セルごとの曲数を数える
+// ジャンルは 0 以上 1 以下なので、1 はいちばん端のセルに入れる
+func grid_counts(genres [][]float64, grid int) map[int]int {
+	counts := make(map[int]int)
+	for _, genre := range genres {
+		cell := 0
+		for _, x := range genre {
+			cell = cell*grid + min(int(x*float64(grid)), grid-1)
+		}
+		counts[cell]++
+	}
+	return counts
+}
+
+// 同じ seed で同じ結果になるよう、map ではなくセルの順に足す
+func grid_entropy(genres [][]float64, grid int) float64 {
+	counts := grid_counts(genres, grid)
+	cells := slices.Sorted(maps.Keys(counts))
+
+	entropy := 0.0
+	for _, cell := range cells {
+		p := float64(counts[cell]) / float64(len(genres))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func grid_richness(genres [][]float64, grid int) int {
+	return len(grid_counts(genres, grid))
+}
+
+// 曲が 2 曲未満の場合は 0
+func mean_pairwise_distance(genres [][]float64) float64 {
+	n := len(genres)
+	if n < 2 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := range n {
+		for j := i + 1; j < n; j++ {
+			sum += math.Sqrt(squared_distance(genres[i], genres[j]))
+		}
+	}
+	return sum / float64(n*(n-1)/2)
+}
+
+// Andrew の単調鎖法で凸包を求め、その面積を返す
+// 曲が 3 曲未満 (または一直線上にある) 場合は 0、ジャンルが 2 次元でない場合は NaN (体積は計算しない)
+func convex_hull_area(genres [][]float64) float64 {
+	if len(genres) == 0 {
+		return 0
+	}
+	if len(genres[0]) != 2 {
+		return math.NaN()
+	}
+	if len(genres) < 3 {
+		return 0
+	}
+
+	points := make([][]float64, len(genres))
+	copy(points, genres)
+	sort.Slice(points, func(i, j int) bool {
+		if points[i][0] != points[j][0] {
+			return points[i][0] < points[j][0]
+		}
+		return points[i][1] < points[j][1]
+	})
+
+	cross := func(o, a, b []float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+
+	// 下側と上側の凸包をつなげる (始点と終点は重複する)
+	hull := make([][]float64, 0, 2*len(points))
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+
+	// 靴紐公式
+	area := 0.0
+	for i := 0; i+1 < len(hull); i++ {
+		area += hull[i][0]*hull[i+1][1] - hull[i+1][0]*hull[i][1]
+	}
+	return math.Abs(area) / 2
+}
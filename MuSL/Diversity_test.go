@@ -0,0 +1,59 @@
+package MuSL
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvexHullArea(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres [][]float64
+		want   float64 // NaN なら計算しない
+	}{
+		{"no songs", [][]float64{}, 0},
+		{"two songs", [][]float64{{0, 0}, {1, 1}}, 0},
+		{"collinear", [][]float64{{0, 0}, {0.5, 0.5}, {1, 1}}, 0},
+		{"triangle", [][]float64{{0, 0}, {1, 0}, {0, 1}}, 0.5},
+		{"square with inner points", [][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0.5, 0.5}, {0.2, 0.7}}, 1},
+		{"duplicates", [][]float64{{0, 0}, {0, 0}, {0.5, 0}, {0.5, 0}, {0, 0.5}}, 0.125},
+		{"one dimension", [][]float64{{0.1}, {0.5}, {0.9}}, math.NaN()},
+		{"three dimensions", [][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}, math.NaN()},
+	}
+
+	for _, test := range tests {
+		got := convex_hull_area(test.genres)
+		if math.IsNaN(test.want) {
+			if !math.IsNaN(got) {
+				t.Errorf("%s: %v, want NaN", test.name, got)
+			}
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// シミュレーションのジャンルは 2 次元なので、サマリーの凸包の面積は常に計算される
+func TestSummeryHullAreaIsComputed(t *testing.T) {
+	sim, err := test_config(ScheduleFixed, 2).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	if err := sim.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	positive := false
+	for _, summery := range sim.GetSummery() {
+		if math.IsNaN(summery.GenreHullArea) || math.IsNaN(summery.NewGenreHullArea) {
+			t.Fatalf("iteration %d: hull area was not computed", summery.Iteration)
+		}
+		positive = positive || summery.GenreHullArea > 0
+	}
+	if !positive {
+		t.Error("hull area is always 0")
+	}
+}
@@ -0,0 +1,225 @@
+package MuSL
+
+// エージェントが自分以外 (他のエージェント、共有された Event や Song) に及ぼす副作用
+// 逐次実行では即座に適用する。
+// 並列実行ではフェーズの間は記録するだけにして、フェーズの終わりにエージェントの順に Apply する。
+// これにより、並列度によらず同じ結果になる。
+// SimulationObserver への通知も、副作用を適用するときに行う。
+type Effects struct {
+	buffered      bool
+	new_born_pool *[]*Agent
+	observers     []SimulationObserver
+	log           []effect
+}
+
+type effect interface {
+	apply(e *Effects)
+}
+
+type reproduction_cost_effect struct {
+	agent *Agent
+	cost  float64
+}
+
+type entry_effect struct {
+	song *Song
+}
+
+type evaluation_effect struct {
+	listener   *Agent
+	event      *Event
+	song       *Song
+	evaluation float64
+	cost       float64
+}
+
+type reward_effect struct {
+	event  *Event
+	song   *Song
+	reward float64
+	kind   PayoutKind
+}
+
+type recommendation_effect struct {
+	listener *Agent
+	song     *Song
+	event    *Event
+}
+
+type song_effect struct {
+	song *Song
+}
+
+type birth_effect struct {
+	child  *Agent
+	parent *Agent
+	spouse *Agent
+}
+
+type event_effect struct {
+	organizer        *Agent
+	event            *Event
+	settled          bool
+	fee              float64
+	organizer_income float64
+}
+
+// 即座に適用する Effects を作成する
+func MakeImmediateEffects(new_born_pool *[]*Agent, observers []SimulationObserver) *Effects {
+	return &Effects{
+		buffered:      false,
+		new_born_pool: new_born_pool,
+		observers:     observers,
+		log:           nil,
+	}
+}
+
+// 記録しておいて Apply で適用する Effects を作成する
+func MakeBufferedEffects(new_born_pool *[]*Agent, observers []SimulationObserver) *Effects {
+	return &Effects{
+		buffered:      true,
+		new_born_pool: new_born_pool,
+		observers:     observers,
+		log:           make([]effect, 0),
+	}
+}
+
+func (e *Effects) push(effect effect) {
+	if e.buffered {
+		e.log = append(e.log, effect)
+		return
+	}
+	effect.apply(e)
+}
+
+// エージェントのエネルギーから子供を作る費用を差し引く
+func (e *Effects) PayReproductionCost(agent *Agent, cost float64) {
+	e.push(reproduction_cost_effect{agent, cost})
+}
+
+// 曲がイベントに参加したことを記録する
+func (e *Effects) EnterEvent(song *Song) {
+	e.push(entry_effect{song})
+}
+
+// リスナーの評価と評価費用をイベントに記録する
+func (e *Effects) Evaluate(listener *Agent, event *Event, song *Song, evaluation, cost float64) {
+	e.push(evaluation_effect{listener, event, song, evaluation, cost})
+}
+
+// 曲の作成者にイベントの報酬を支払う
+func (e *Effects) Reward(event *Event, song *Song, reward float64, kind PayoutKind) {
+	e.push(reward_effect{event, song, reward, kind})
+}
+
+// リスナーに曲をおすすめする
+func (e *Effects) Recommend(listener *Agent, song *Song, event *Event) {
+	e.push(recommendation_effect{listener, song, event})
+}
+
+// 作成された曲に ID を振る
+func (e *Effects) NewSong(song *Song) {
+	e.push(song_effect{song})
+}
+
+// 生まれた子供に ID を振ってプールに入れる
+func (e *Effects) Born(child, parent, spouse *Agent) {
+	e.push(birth_effect{child, parent, spouse})
+}
+
+// イベントに ID を振り、開催を知らせる
+func (e *Effects) OpenEvent(organizer *Agent, event *Event) {
+	e.push(event_effect{organizer, event, false, 0, 0})
+}
+
+// イベントの中抜きと運営者の受け取った額を記録し、精算を知らせる
+func (e *Effects) SettleEvent(organizer *Agent, event *Event, fee, organizer_income float64) {
+	e.push(event_effect{organizer, event, true, fee, organizer_income})
+}
+
+// 記録した副作用を記録した順に適用する
+func (e *Effects) Apply() {
+	for _, effect := range e.log {
+		effect.apply(e)
+	}
+	e.log = e.log[:0]
+}
+
+func (effect reproduction_cost_effect) apply(e *Effects) {
+	effect.agent.energy -= effect.cost
+	effect.agent.income.ReproductionCost += effect.cost
+}
+
+func (effect entry_effect) apply(e *Effects) {
+	effect.song.stats.num_events++
+}
+
+func (effect evaluation_effect) apply(e *Effects) {
+	effect.event.evaluation_pool[effect.song] = append(effect.event.evaluation_pool[effect.song], effect.evaluation)
+	effect.event.evaluation_reward[effect.song] += effect.cost
+
+	stats := &effect.song.stats
+	stats.num_evaluations++
+	stats.sum_evaluation += effect.evaluation
+	stats.sum_sq_evaluation += effect.evaluation * effect.evaluation
+
+	for _, observer := range e.observers {
+		observer.OnSongEvaluated(effect.listener, effect.event, effect.song, effect.evaluation)
+	}
+}
+
+func (effect reward_effect) apply(e *Effects) {
+	won_major := effect.kind == PayoutMajorBonus
+
+	effect.song.creator.energy += effect.reward
+	effect.song.creator.income.addPayout(effect.kind, effect.reward)
+	effect.song.stats.total_reward += effect.reward
+	if won_major {
+		effect.song.stats.won_major = true
+	}
+
+	for _, observer := range e.observers {
+		observer.OnPayout(effect.event, effect.song, effect.reward, won_major)
+	}
+}
+
+func (effect recommendation_effect) apply(e *Effects) {
+	listener := effect.listener.listener
+	listener.incoming_songs = append(listener.incoming_songs, effect.song)
+	listener.song_events = append(listener.song_events, effect.event)
+	effect.event.num_recommendations++
+}
+
+func (effect song_effect) apply(e *Effects) {
+	effect.song.id = GetNewSongID()
+
+	for _, observer := range e.observers {
+		observer.OnSongCreated(effect.song)
+	}
+}
+
+func (effect birth_effect) apply(e *Effects) {
+	effect.child.id = GetNewID()
+	*e.new_born_pool = append(*e.new_born_pool, effect.child)
+
+	for _, observer := range e.observers {
+		observer.OnAgentBorn(effect.child, effect.parent, effect.spouse)
+	}
+}
+
+func (effect event_effect) apply(e *Effects) {
+	if effect.settled {
+		effect.event.fee = effect.fee
+		effect.event.organizer_income = effect.organizer_income
+	} else {
+		effect.event.id = GetNewEventID()
+	}
+
+	for _, observer := range e.observers {
+		if effect.settled {
+			observer.OnEventSettled(effect.organizer, effect.event)
+		} else {
+			observer.OnEventOpened(effect.organizer, effect.event)
+		}
+	}
+}
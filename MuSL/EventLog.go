@@ -0,0 +1,203 @@
+package MuSL
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// 精算されたイベント 1 件の記録
+// 精算されずに終わったイベント (運営者が削除された、またはシミュレーションが終わった) は SettleIteration が -1 になる。
+type EventLog struct {
+	ID                 int             `json:"id"`
+	OrganizerID        int             `json:"organizer_id"`
+	Type               string          `json:"type"`
+	OpenIteration      int             `json:"open_iteration"`
+	SettleIteration    int             `json:"settle_iteration"`
+	NumSongs           int             `json:"num_songs"`           // creator_pool の曲数
+	NumListeners       int             `json:"num_listeners"`       // listener_pool の人数
+	NumRecommendations int             `json:"num_recommendations"` // リスナーに届いたおすすめの数
+	NumEvaluations     int             `json:"num_evaluations"`     // 集まった評価の数
+	EvaluationReward   float64         `json:"evaluation_reward"`   // evaluation_reward の合計
+	Fee                float64         `json:"fee"`                 // 中抜き
+	OrganizerIncome    float64         `json:"organizer_income"`    // 運営者が受け取った額
+	Winners            []int           `json:"winners"`             // メジャーイベントで上位に入った曲の ID
+	Payouts            []CreatorPayout `json:"payouts"`             // 作成者ごとの報酬 (最初に支払われた順)
+}
+
+type CreatorPayout struct {
+	CreatorID int     `json:"creator_id"`
+	Amount    float64 `json:"amount"`
+}
+
+// イベントが精算されるたびに EventLog を 1 行の JSON (NDJSON) で書き出す SimulationObserver
+// 報酬の内訳は OnPayout から集める。
+type EventLogger struct {
+	NopObserver
+	sim       *Simulation
+	writer    *bufio.Writer
+	encoder   *json.Encoder
+	iteration int
+	pending   map[*Event]*EventLog // 支払いが始まって精算を待っているイベント
+	err       error
+}
+
+// sim の Simulation.AddObserver に登録して使う
+// シミュレーションが終わったら Close で精算されていないイベントを書き出す
+func MakeEventLogger(sim *Simulation, w io.Writer) *EventLogger {
+	writer := bufio.NewWriter(w)
+	return &EventLogger{
+		sim:       sim,
+		writer:    writer,
+		encoder:   json.NewEncoder(writer),
+		iteration: sim.iteration,
+		pending:   make(map[*Event]*EventLog),
+		err:       nil,
+	}
+}
+
+func (l *EventLogger) OnIterationStart(iteration int) {
+	l.iteration = iteration
+}
+
+func (l *EventLogger) OnPayout(event *Event, song *Song, reward float64, won_major bool) {
+	log, ok := l.pending[event]
+	if !ok {
+		log = MakeEventLog(event, -1)
+		l.pending[event] = log
+	}
+
+	if won_major {
+		log.Winners = append(log.Winners, song.id)
+	}
+	for i := range log.Payouts {
+		if log.Payouts[i].CreatorID == song.creator_id {
+			log.Payouts[i].Amount += reward
+			return
+		}
+	}
+	log.Payouts = append(log.Payouts, CreatorPayout{song.creator_id, reward})
+}
+
+func (l *EventLogger) OnEventSettled(organizer *Agent, event *Event) {
+	log, ok := l.pending[event]
+	if ok {
+		delete(l.pending, event)
+	} else {
+		log = MakeEventLog(event, -1)
+	}
+
+	// 報酬以外は精算が終わってから集計する
+	payouts := log.Payouts
+	winners := log.Winners
+	*log = *MakeEventLog(event, l.iteration)
+	log.Winners = winners
+	log.Payouts = payouts
+
+	l.write(log)
+}
+
+// 削除された運営者のイベントは精算されない
+func (l *EventLogger) OnAgentDied(agent *Agent) {
+	for _, event := range agent.organizer.created_events {
+		l.write(MakeEventLog(event, -1))
+	}
+}
+
+// 途中で止まってもそれまでの記録が残るよう、イテレーションごとに flush する
+func (l *EventLogger) OnIterationEnd(summery *PublicSummery) {
+	if l.err == nil {
+		l.err = l.writer.Flush()
+	}
+}
+
+func (l *EventLogger) write(log *EventLog) {
+	// 一度失敗したら書き込まない
+	if l.err != nil {
+		return
+	}
+	l.err = l.encoder.Encode(log)
+}
+
+// チェックポイントから再開したシミュレーションの続きを書くために、中断前に書かれた記録 r のうち
+// チェックポイントまでに書かれていたものを書き直す。通知を受ける前に呼ぶ。
+// 精算されたイベントは精算したイテレーションで、精算されなかったイベントは、
+// チェックポイントの時点で生きている運営者がまだ持っていたか、その後に開催されたものを除く (再開後にもう一度書き出される)。
+func (l *EventLogger) Resume(r io.Reader) error {
+	pending := make(map[int]bool)
+	for _, agent := range l.sim.agents {
+		if agent.energy > 0 {
+			for _, event := range agent.organizer.created_events {
+				pending[event.id] = true
+			}
+		}
+	}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var log EventLog
+		if err := decoder.Decode(&log); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		keep := log.SettleIteration >= 0 && log.SettleIteration <= l.sim.iteration
+		if log.SettleIteration < 0 {
+			keep = log.OpenIteration <= l.sim.iteration && !pending[log.ID]
+		}
+		if keep {
+			l.write(&log)
+		}
+	}
+
+	if l.err == nil {
+		l.err = l.writer.Flush()
+	}
+	return l.err
+}
+
+// 残っている運営者の精算されていないイベントを書き出し、バッファを flush する
+// それまでに起きたエラーがあれば返す。
+func (l *EventLogger) Close() error {
+	for _, agent := range l.sim.agents {
+		// 最後のイテレーションで死んだ運営者のイベントは OnAgentDied で書き出している
+		if agent.energy <= 0 {
+			continue
+		}
+		for _, event := range agent.organizer.created_events {
+			l.write(MakeEventLog(event, -1))
+		}
+	}
+
+	if l.err != nil {
+		return l.err
+	}
+	l.err = l.writer.Flush()
+	return l.err
+}
+
+// event の現在の状態から EventLog を作成する (報酬の内訳は空)
+func MakeEventLog(event *Event, settle_iteration int) *EventLog {
+	log := &EventLog{
+		ID:                 event.id,
+		OrganizerID:        event.organizer_id,
+		Type:               event.event_type,
+		OpenIteration:      event.iteration,
+		SettleIteration:    settle_iteration,
+		NumSongs:           len(event.creator_pool),
+		NumListeners:       len(event.listener_pool),
+		NumRecommendations: event.num_recommendations,
+		NumEvaluations:     0,
+		EvaluationReward:   0,
+		Fee:                event.fee,
+		OrganizerIncome:    event.organizer_income,
+		Winners:            make([]int, 0),
+		Payouts:            make([]CreatorPayout, 0),
+	}
+	for _, song := range event.creator_pool {
+		log.NumEvaluations += len(event.evaluation_pool[song])
+		log.EvaluationReward += event.evaluation_reward[song]
+	}
+	return log
+}
@@ -0,0 +1,104 @@
+package MuSL
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// 途中のチェックポイントから再開して Resume した記録は、中断しなかった場合と同じになる
+func TestEventLoggerResume(t *testing.T) {
+	for _, seed := range []int64{5, 9} {
+		reset_id_counters()
+		sim, err := test_config(ScheduleFixed, seed).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+
+		var full bytes.Buffer
+		logger := MakeEventLogger(sim, &full)
+		sim.AddObserver(logger)
+
+		var checkpoint bytes.Buffer
+		if _, err := sim.Advance(15); err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.SaveCheckpoint(&checkpoint); err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := logger.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// 別のプロセスで再開する
+		reset_id_counters()
+		resumed, err := LoadCheckpoint(&checkpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed.SetVerbose(false)
+
+		var rewritten bytes.Buffer
+		resumed_logger := MakeEventLogger(resumed, &rewritten)
+		if err := resumed_logger.Resume(bytes.NewReader(full.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		resumed.AddObserver(resumed_logger)
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := resumed_logger.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if full.Len() == 0 {
+			t.Errorf("seed %d: no events were logged", seed)
+		}
+		if rewritten.String() != full.String() {
+			t.Errorf("seed %d: resumed event log differs from the uninterrupted one", seed)
+		}
+	}
+}
+
+// 最後のイテレーションで死んだ運営者のイベントを含め、どのイベントも 1 回だけ書き出される
+func TestEventLoggerWritesEachEventOnce(t *testing.T) {
+	for _, seed := range []int64{1, 2, 3, 8} {
+		c := test_config(ScheduleFixed, seed)
+		c.NumAgents = 80
+		sim, err := c.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+
+		var buffer bytes.Buffer
+		logger := MakeEventLogger(sim, &buffer)
+		sim.AddObserver(logger)
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if err := logger.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		seen := make(map[int]bool)
+		decoder := json.NewDecoder(&buffer)
+		for decoder.More() {
+			var log EventLog
+			if err := decoder.Decode(&log); err != nil {
+				t.Fatal(err)
+			}
+			if seen[log.ID] {
+				t.Errorf("seed %d: event %d of organizer %d is logged twice", seed, log.ID, log.OrganizerID)
+			}
+			seen[log.ID] = true
+		}
+		if len(seen) == 0 {
+			t.Errorf("seed %d: no events were logged", seed)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package MuSL
+
+import (
+	"slices"
+)
+
+// 個数の分布。値がない場合はすべて 0 になる。
+type CountStats struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	Max    float64 `json:"max"`
+}
+
+// 個数の分布を計算する。四分位数は線形補間で求める。
+func MeasureCounts(counts []int) *CountStats {
+	stats := &CountStats{Count: len(counts)}
+	if len(counts) == 0 {
+		return stats
+	}
+
+	sorted := make([]float64, len(counts))
+	for i, count := range counts {
+		sorted[i] = float64(count)
+		stats.Mean += float64(count)
+	}
+	slices.Sort(sorted)
+	stats.Mean /= float64(len(sorted))
+
+	stats.Min = sorted[0]
+	stats.Q1 = quantile(sorted, 0.25)
+	stats.Median = quantile(sorted, 0.5)
+	stats.Q3 = quantile(sorted, 0.75)
+	stats.Max = sorted[len(sorted)-1]
+
+	return stats
+}
+
+// 集計 (III) から、そのイテレーションのイベントの統計を計算する (11)
+// 曲数とリスナー数はそのイテレーションに開催されたイベント、評価の網羅率と報酬の集中度は精算されたイベントについて求める。
+func (s *Summery) CalculateEventStats() {
+	s.songs_per_event = MeasureCounts(s.event_num_songs)         // 11-1
+	s.listeners_per_event = MeasureCounts(s.event_num_listeners) // 11-2
+	s.avg_songs_per_event = s.songs_per_event.Mean               // 11-3
+	s.avg_listeners_per_event = s.listeners_per_event.Mean       // 11-4
+
+	if s.num_settled_songs > 0 {
+		s.evaluation_coverage = float64(s.num_evaluated_songs) / float64(s.num_settled_songs) // 11-5
+	}
+	if s.major_payout > 0 {
+		s.winner_payout_share = s.winner_payout / s.major_payout // 11-6
+	}
+}
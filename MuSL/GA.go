@@ -16,7 +16,7 @@ type Evolvable interface {
 
 type GAParams struct {
 	mutation_rate     float64 // 例: 0.1
-	mutation_strength float64 // 例: 0.05
+	mutation_strength float64 // 突然変異で [-mutation_strength, mutation_strength] の一様乱数を加える。例: 0.05
 }
 
 func MakeGAParams(mutation_rate, mutation_strength float64) *GAParams {
@@ -26,11 +26,13 @@ func MakeGAParams(mutation_rate, mutation_strength float64) *GAParams {
 	}
 }
 
-func ReproduceGA[T Evolvable](p1, p2 T, params *GAParams, default_params T, copy_func func(T) T) (T, error) {
+// frozen[i] が true の遺伝子は交叉も突然変異もせず、p1 の値をそのまま引き継ぐ (乱数も使わない)
+// frozen が nil ならすべての遺伝子を進化させる
+func ReproduceGA[T Evolvable](p1, p2 T, params *GAParams, default_params T, copy_func func(T) T, frozen []bool, rng *rand.Rand) (T, error) {
 	g1 := p1.ToGene()
 	g2 := p2.ToGene()
 
-	childGene := CrossoverAndMutate(g1, g2, params)
+	childGene := CrossoverAndMutate(g1, g2, params, frozen, rng)
 
 	child := copy_func(default_params)
 
@@ -38,17 +40,22 @@ func ReproduceGA[T Evolvable](p1, p2 T, params *GAParams, default_params T, copy
 	return child, err
 }
 
-func CrossoverAndMutate(g1, g2 []float64, params *GAParams) []float64 {
+func CrossoverAndMutate(g1, g2 []float64, params *GAParams, frozen []bool, rng *rand.Rand) []float64 {
 	childGene := make([]float64, len(g1))
 	for i := range g1 {
-		if rand.Float64() < 0.5 {
+		if frozen != nil && frozen[i] {
+			childGene[i] = g1[i]
+			continue
+		}
+
+		if rng.Float64() < 0.5 {
 			childGene[i] = g1[i]
 		} else {
 			childGene[i] = g2[i]
 		}
 
-		if rand.Float64() < params.mutation_rate {
-			childGene[i] += params.mutation_strength * (rand.Float64()*2.0 - 1.0)
+		if rng.Float64() < params.mutation_rate {
+			childGene[i] += params.mutation_strength * (rng.Float64()*2.0 - 1.0)
 		}
 
 		childGene[i] = math.Max(0.0, math.Min(1.0, childGene[i]))
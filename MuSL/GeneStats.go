@@ -0,0 +1,115 @@
+package MuSL
+
+import (
+	"slices"
+)
+
+// 遺伝子のヒストグラムのビンの数。遺伝子は 0 以上 1 以下なので、幅は 1/10 になる。
+const gene_histogram_bins = 10
+
+// 生きているエージェント全体と役割ごとの、遺伝子の分布
+// 各スライスは ToGene の順 (GeneNames) に並ぶ。
+type GeneDistribution struct {
+	All        []GeneStats `json:"all"`
+	Creators   []GeneStats `json:"creators"`
+	Listeners  []GeneStats `json:"listeners"`
+	Organizers []GeneStats `json:"organizers"`
+}
+
+// 1 つの遺伝子の分布。エージェントがいない場合はヒストグラム以外 0 になる。
+type GeneStats struct {
+	Name      string  `json:"name"`
+	Count     int     `json:"count"`
+	Mean      float64 `json:"mean"`
+	Variance  float64 `json:"variance"` // 母分散
+	Min       float64 `json:"min"`
+	Q1        float64 `json:"q1"`
+	Median    float64 `json:"median"`
+	Q3        float64 `json:"q3"`
+	Max       float64 `json:"max"`
+	Histogram []int   `json:"histogram"` // [0, 0.1), [0.1, 0.2), ..., [0.9, 1.0]
+}
+
+// 生きているエージェントの遺伝子の分布を計算する (9)
+func (s *Summery) CalculateGeneDistribution(agents []*Agent) {
+	// groups[0] は全体、groups[1:] は役割ごと
+	groups := make([][][]float64, 4)
+	for _, agent := range agents {
+		// 生きているエージェントのみ
+		if agent.energy <= 0 {
+			continue
+		}
+		gene := agent.ToGene()
+		groups[0] = append(groups[0], gene)
+		for r, has_role := range agent.role {
+			if has_role {
+				groups[r+1] = append(groups[r+1], gene)
+			}
+		}
+	}
+
+	s.gene_distribution = &GeneDistribution{
+		All:        gene_stats(groups[0]),
+		Creators:   gene_stats(groups[1]),
+		Listeners:  gene_stats(groups[2]),
+		Organizers: gene_stats(groups[3]),
+	}
+}
+
+// genes (エージェントごとの ToGene) から遺伝子ごとの分布を計算する
+func gene_stats(genes [][]float64) []GeneStats {
+	stats := make([]GeneStats, GeneLength)
+	values := make([]float64, len(genes))
+	for g := range GeneLength {
+		for i, gene := range genes {
+			values[i] = gene[g]
+		}
+		stats[g] = MeasureGene(GeneNames[g], values)
+	}
+	return stats
+}
+
+// 0 以上 1 以下の値の分布を計算する。四分位数は線形補間で求める。
+func MeasureGene(name string, values []float64) GeneStats {
+	stats := GeneStats{
+		Name:      name,
+		Count:     len(values),
+		Histogram: make([]int, gene_histogram_bins),
+	}
+	if len(values) == 0 {
+		return stats
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	sum := 0.0
+	for _, value := range sorted {
+		sum += value
+		stats.Histogram[min(int(value*gene_histogram_bins), gene_histogram_bins-1)]++
+	}
+	stats.Mean = sum / float64(len(sorted))
+
+	for _, value := range sorted {
+		stats.Variance += (value - stats.Mean) * (value - stats.Mean)
+	}
+	stats.Variance /= float64(len(sorted))
+
+	stats.Min = sorted[0]
+	stats.Q1 = quantile(sorted, 0.25)
+	stats.Median = quantile(sorted, 0.5)
+	stats.Q3 = quantile(sorted, 0.75)
+	stats.Max = sorted[len(sorted)-1]
+
+	return stats
+}
+
+// 昇順に並んだ sorted の q 分位数
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	i := int(position)
+	if i+1 >= len(sorted) {
+		return sorted[i]
+	}
+	return sorted[i] + (position-float64(i))*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,56 @@
+package MuSL
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestMeasureGene(t *testing.T) {
+	histogram := func(bins ...int) []int {
+		h := make([]int, gene_histogram_bins)
+		for _, bin := range bins {
+			h[bin]++
+		}
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   GeneStats
+	}{
+		{"empty", nil, GeneStats{Histogram: histogram()}},
+		{"one agent", []float64{0.5}, GeneStats{
+			Count: 1, Mean: 0.5, Min: 0.5, Q1: 0.5, Median: 0.5, Q3: 0.5, Max: 0.5, Histogram: histogram(5),
+		}},
+		{"bounds", []float64{1, 0}, GeneStats{
+			Count: 2, Mean: 0.5, Variance: 0.25, Min: 0, Q1: 0.25, Median: 0.5, Q3: 0.75, Max: 1, Histogram: histogram(0, 9),
+		}},
+		{"quartiles", []float64{0.75, 0, 1, 0.25, 0.5}, GeneStats{
+			Count: 5, Mean: 0.5, Variance: 0.125, Min: 0, Q1: 0.25, Median: 0.5, Q3: 0.75, Max: 1, Histogram: histogram(0, 2, 5, 7, 9),
+		}},
+		{"interpolation", []float64{0, 0.5, 0.5, 1}, GeneStats{
+			Count: 4, Mean: 0.5, Variance: 0.125, Min: 0, Q1: 0.375, Median: 0.5, Q3: 0.625, Max: 1, Histogram: histogram(0, 5, 5, 9),
+		}},
+	}
+
+	for _, test := range tests {
+		values := slices.Clone(test.values)
+		got := MeasureGene("innovation", values)
+		want := test.want
+		want.Name = "innovation"
+
+		near := func(a, b float64) bool { return math.Abs(a-b) <= 1e-12 }
+		if got.Name != want.Name || got.Count != want.Count ||
+			!near(got.Mean, want.Mean) || !near(got.Variance, want.Variance) ||
+			!near(got.Min, want.Min) || !near(got.Q1, want.Q1) || !near(got.Median, want.Median) ||
+			!near(got.Q3, want.Q3) || !near(got.Max, want.Max) ||
+			!slices.Equal(got.Histogram, want.Histogram) {
+			t.Errorf("%s: %+v, want %+v", test.name, got, want)
+		}
+		if !slices.Equal(values, test.values) {
+			t.Errorf("%s: values changed to %v", test.name, values)
+		}
+	}
+}
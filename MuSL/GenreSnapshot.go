@@ -0,0 +1,205 @@
+package MuSL
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+)
+
+// ジャンルのスナップショットの保存形式
+const (
+	GenreRaw     = "raw"     // [][]float64 のまま (AllGenres)
+	GenreCompact = "compact" // 量子化して差分符号化したバイナリを base64 にしたもの (GenresCompact)
+)
+
+// 量子化の段階数。ジャンルは 0 以上 1 以下なので、1/65535 の精度で保存される。
+const genre_quantization = 65535
+
+// ジャンルのスナップショットの取り方
+type GenreSnapshotParams struct {
+	every    int          // every イテレーションごとに取る (0 なら at のみ)
+	at       map[int]bool // 必ず取るイテレーション
+	sample   int          // 1 回に保存する曲数の上限 (0 なら全曲)
+	encoding string       // 保存形式
+}
+
+func MakeGenreSnapshotParams(every int, at []int, sample int, encoding string) (*GenreSnapshotParams, error) {
+	if every < 0 || sample < 0 {
+		return nil, errors.New("genre snapshot every and sample must not be negative")
+	}
+	if encoding != GenreRaw && encoding != GenreCompact {
+		return nil, errors.New("unknown genre encoding: " + strconv.Quote(encoding))
+	}
+
+	at_set := make(map[int]bool, len(at))
+	for _, iteration := range at {
+		at_set[iteration] = true
+	}
+
+	return &GenreSnapshotParams{
+		every:    every,
+		at:       at_set,
+		sample:   sample,
+		encoding: encoding,
+	}, nil
+}
+
+// 毎イテレーション全曲をそのまま保存する (従来通り)
+func DefaultGenreSnapshotParams() *GenreSnapshotParams {
+	params, _ := MakeGenreSnapshotParams(1, nil, 0, GenreRaw)
+	return params
+}
+
+// iteration でスナップショットを取るかどうか
+func (p *GenreSnapshotParams) ShouldTake(iteration int) bool {
+	if p.at[iteration] {
+		return true
+	}
+	return p.every > 0 && iteration%p.every == 0
+}
+
+// 生きている作成者の memory にある曲のジャンルを保存する (6)
+// sample が指定されていれば、rng で曲を選んで間引く。
+func (s *Summery) TakeGenreSnapshot(agents []*Agent, params *GenreSnapshotParams, rng *rand.Rand) {
+	if !params.ShouldTake(s.iteration) {
+		return
+	}
+
+	genres := make([][]float64, 0)
+	for _, agent := range agents {
+		// 生きているエージェントのみ
+		if agent.energy <= 0 {
+			continue
+		}
+		for _, song := range agent.creator.memory.Songs() {
+			genres = append(genres, song.genre)
+		}
+	}
+
+	// 間引く (元の順序は保つ)
+	if params.sample > 0 && len(genres) > params.sample {
+		indices := rng.Perm(len(genres))[:params.sample]
+		slices.Sort(indices)
+		sampled := make([][]float64, params.sample)
+		for i, index := range indices {
+			sampled[i] = genres[index]
+		}
+		genres = sampled
+	}
+
+	if params.encoding == GenreCompact {
+		s.genres_compact = EncodeGenres(genres)
+	} else {
+		s.all_genres = genres
+	}
+}
+
+// ジャンルを量子化し、直前の曲との差分を可変長整数で並べて base64 にする
+// 形式: uvarint(次元数), uvarint(曲数), 各曲の各次元について varint(前の曲との差)
+// 量子化するので可逆ではない。DecodeGenres で戻した値は元の値と最大 1/(2*65535) ずれ、0 未満と 1 より大きい値は 0 と 1 になる。
+func EncodeGenres(genres [][]float64) string {
+	dim := 0
+	if len(genres) > 0 {
+		dim = len(genres[0])
+	}
+
+	buffer := make([]byte, 0, 2*binary.MaxVarintLen64+len(genres)*dim*2)
+	buffer = binary.AppendUvarint(buffer, uint64(dim))
+	buffer = binary.AppendUvarint(buffer, uint64(len(genres)))
+
+	previous := make([]int64, dim)
+	for _, genre := range genres {
+		for d := range dim {
+			q := int64(math.Round(math.Max(0, math.Min(1, genre[d])) * genre_quantization))
+			buffer = binary.AppendVarint(buffer, q-previous[d])
+			previous[d] = q
+		}
+	}
+
+	return base64.StdEncoding.EncodeToString(buffer)
+}
+
+// EncodeGenres で符号化したジャンルを元に戻す
+func DecodeGenres(data string) ([][]float64, error) {
+	buffer, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+
+	read_uvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(buffer)
+		if n <= 0 {
+			return 0, errors.New("invalid compact genres")
+		}
+		buffer = buffer[n:]
+		return v, nil
+	}
+
+	dim, err := read_uvarint()
+	if err != nil {
+		return nil, err
+	}
+	count, err := read_uvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	// 各値は 1 バイト以上なので、残りのバイト数より多くの値は入っていない
+	// (壊れたデータで巨大なスライスを作らないよう、作る前に確かめる)
+	if count == 0 {
+		return [][]float64{}, nil
+	}
+	if dim == 0 || count > uint64(len(buffer))/dim {
+		return nil, errors.New("invalid compact genres: " + strconv.FormatUint(count, 10) + " songs of dimension " +
+			strconv.FormatUint(dim, 10) + " do not fit in " + strconv.Itoa(len(buffer)) + " bytes")
+	}
+
+	genres := make([][]float64, count)
+	previous := make([]int64, dim)
+	for i := range genres {
+		genres[i] = make([]float64, dim)
+		for d := range dim {
+			delta, n := binary.Varint(buffer)
+			if n <= 0 {
+				return nil, errors.New("invalid compact genres")
+			}
+			buffer = buffer[n:]
+			previous[d] += delta
+			genres[i][d] = float64(previous[d]) / genre_quantization
+		}
+	}
+	if len(buffer) > 0 {
+		return nil, errors.New("invalid compact genres: " + strconv.Itoa(len(buffer)) + " trailing bytes")
+	}
+
+	return genres, nil
+}
+
+// サマリーのジャンルを返す (GenresCompact に保存されていれば展開する)
+// summery は変更しない
+func (s *PublicSummery) Genres() ([][]float64, error) {
+	if s.GenresCompact == "" {
+		return s.AllGenres, nil
+	}
+	return DecodeGenres(s.GenresCompact)
+}
+
+// GenresCompact に保存されたジャンルを AllGenres に展開する
+func ExpandGenres(summeries []*PublicSummery) error {
+	for _, summery := range summeries {
+		if summery.GenresCompact == "" {
+			continue
+		}
+		genres, err := DecodeGenres(summery.GenresCompact)
+		if err != nil {
+			return err
+		}
+		summery.AllGenres = genres
+		summery.GenresCompact = ""
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package MuSL
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDecodeGenresRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		genres [][]float64
+		want   [][]float64 // nil なら genres と同じ (量子化の誤差まで)
+	}{
+		{"empty", [][]float64{}, nil},
+		{"one song", [][]float64{{0.25, 0.75}}, nil},
+		{"bounds", [][]float64{{0, 1}, {1, 0}, {0, 0}}, nil},
+		{"rounding", [][]float64{{0.123456789, 0.987654321}, {0.5, 0.000001}}, nil},
+		{"three dimensions", [][]float64{{0.1, 0.2, 0.3}, {0.3, 0.2, 0.1}}, nil},
+		{"clamped", [][]float64{{-0.5, 1.5}}, [][]float64{{0, 1}}},
+	}
+
+	for _, test := range tests {
+		want := test.want
+		if want == nil {
+			want = test.genres
+		}
+
+		got, err := DecodeGenres(EncodeGenres(test.genres))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: %d songs, want %d", test.name, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if len(got[i]) != len(want[i]) {
+				t.Errorf("%s: song %d has dimension %d, want %d", test.name, i, len(got[i]), len(want[i]))
+				continue
+			}
+			for d := range want[i] {
+				if math.Abs(got[i][d]-want[i][d]) > 0.5/genre_quantization+1e-12 {
+					t.Errorf("%s: song %d dim %d: %v, want %v", test.name, i, d, got[i][d], want[i][d])
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeGenresErrors(t *testing.T) {
+	encode := func(values ...uint64) string {
+		buffer := make([]byte, 0)
+		for _, v := range values {
+			buffer = binary.AppendUvarint(buffer, v)
+		}
+		return base64.StdEncoding.EncodeToString(buffer)
+	}
+	valid := EncodeGenres([][]float64{{0.1, 0.2}, {0.3, 0.4}})
+	raw, _ := base64.StdEncoding.DecodeString(valid)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not base64", "!!!"},
+		{"empty", ""},
+		{"no count", encode(2)},
+		{"huge count", encode(2, math.MaxUint64)},
+		{"huge dimension", encode(math.MaxUint64, 1)},
+		{"count larger than the data", encode(2, 1000, 0, 0)},
+		{"songs without dimension", encode(0, 5)},
+		{"truncated", base64.StdEncoding.EncodeToString(raw[:len(raw)-1])},
+		{"trailing bytes", base64.StdEncoding.EncodeToString(append(raw, 0))},
+	}
+
+	for _, test := range tests {
+		if genres, err := DecodeGenres(test.data); err == nil {
+			t.Errorf("%s: no error, got %v", test.name, genres)
+		}
+	}
+}
+
+// WriteGenreCSV は compact のスナップショットも書き出すが、サマリーは変更しない
+func TestWriteGenreCSVKeepsSummeries(t *testing.T) {
+	compact := EncodeGenres([][]float64{{1, 0}})
+	summeries := []*PublicSummery{
+		{Iteration: 0, AllGenres: [][]float64{{0.1, 0.2}}},
+		{Iteration: 1, GenresCompact: compact},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteGenreCSV(&buffer, summeries); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "iteration,song,dim_0,dim_1\n0,0,0.1,0.2\n1,0,1,0\n"
+	if buffer.String() != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", buffer.String(), want)
+	}
+	if summeries[1].GenresCompact != compact || summeries[1].AllGenres != nil {
+		t.Error("WriteGenreCSV changed the compact summery")
+	}
+
+	summeries[1].GenresCompact = "!!!"
+	if err := WriteGenreCSV(&buffer, summeries); err == nil || !strings.Contains(err.Error(), "illegal base64") {
+		t.Errorf("broken snapshot: got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package MuSL
+
+// イベントの報酬の種類
+type PayoutKind int
+
+const (
+	PayoutMajorBonus  PayoutKind = iota // メジャーイベントで上位に入った曲への報酬
+	PayoutFlatShare                     // イベントの全曲に均等に分ける報酬
+	PayoutMinorRebate                   // マイナーイベントで評価報酬から還元する報酬
+)
+
+// エネルギーの増減の出どころごとの内訳
+// 支出も正の値で表す。
+type IncomeBreakdown struct {
+	// 収入
+	EvaluationPayoff float64 `json:"evaluation_payoff"` // 聴取者が評価によって得た額
+	OrganizerFee     float64 `json:"organizer_fee"`     // 運営者がイベントの精算で受け取った額
+	MajorBonus       float64 `json:"major_bonus"`       // PayoutMajorBonus
+	FlatShare        float64 `json:"flat_share"`        // PayoutFlatShare
+	MinorRebate      float64 `json:"minor_rebate"`      // PayoutMinorRebate
+
+	// 支出
+	EvaluationFee    float64 `json:"evaluation_fee"`    // 聴取者が支払った評価費用
+	CreationCost     float64 `json:"creation_cost"`     // 作曲の費用
+	OrganizationCost float64 `json:"organization_cost"` // イベントの開催費用
+	ReproductionCost float64 `json:"reproduction_cost"` // 子供を作る費用
+
+	// 合計 (add でのみ計算する)
+	Gained float64 `json:"gained"`
+	Spent  float64 `json:"spent"`
+}
+
+// そのイテレーションに行動したエージェント全体と役割ごとの、そのイテレーションのエネルギーの増減の内訳
+// 複数の役割を持つエージェントは、それぞれの役割で数える。
+type IncomeDecomposition struct {
+	All        IncomeBreakdown `json:"all"`
+	Creators   IncomeBreakdown `json:"creators"`
+	Listeners  IncomeBreakdown `json:"listeners"`
+	Organizers IncomeBreakdown `json:"organizers"`
+}
+
+// イベントの報酬として得た額
+func (b *IncomeBreakdown) EventIncome() float64 {
+	return b.MajorBonus + b.FlatShare + b.MinorRebate
+}
+
+// kind の報酬を記録する
+func (b *IncomeBreakdown) addPayout(kind PayoutKind, reward float64) {
+	switch kind {
+	case PayoutMajorBonus:
+		b.MajorBonus += reward
+	case PayoutFlatShare:
+		b.FlatShare += reward
+	case PayoutMinorRebate:
+		b.MinorRebate += reward
+	}
+}
+
+// other を加算し、合計を計算し直す
+func (b *IncomeBreakdown) add(other *IncomeBreakdown) {
+	b.EvaluationPayoff += other.EvaluationPayoff
+	b.OrganizerFee += other.OrganizerFee
+	b.MajorBonus += other.MajorBonus
+	b.FlatShare += other.FlatShare
+	b.MinorRebate += other.MinorRebate
+	b.EvaluationFee += other.EvaluationFee
+	b.CreationCost += other.CreationCost
+	b.OrganizationCost += other.OrganizationCost
+	b.ReproductionCost += other.ReproductionCost
+
+	b.Gained = b.EvaluationPayoff + b.OrganizerFee + b.EventIncome()
+	b.Spent = b.EvaluationFee + b.CreationCost + b.OrganizationCost + b.ReproductionCost
+}
+
+// そのイテレーションに行動したエージェントのエネルギーの増減を、役割ごとに集計する (10)
+// そのイテレーションで死んだエージェントの収入と支出も含める。
+func (s *Summery) CalculateIncome(agents []*Agent) {
+	decomposition := &IncomeDecomposition{}
+	for _, agent := range agents {
+		decomposition.All.add(&agent.income)
+		if agent.role[0] {
+			decomposition.Creators.add(&agent.income)
+		}
+		if agent.role[1] {
+			decomposition.Listeners.add(&agent.income)
+		}
+		if agent.role[2] {
+			decomposition.Organizers.add(&agent.income)
+		}
+	}
+	s.income_decomposition = decomposition
+}
@@ -0,0 +1,48 @@
+package MuSL
+
+import (
+	"math"
+	"testing"
+)
+
+// 収入と支出の合計は、そのイテレーションで死んだエージェントを含めて、行動したエージェントのエネルギーの変化と一致する
+func TestIncomeIncludesDeadAgents(t *testing.T) {
+	for _, seed := range []int64{3, 8, 13} {
+		sim, err := test_config(ScheduleFixed, seed).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+
+		deaths := 0
+		for sim.iteration < sim.n_iter {
+			before := make(map[*Agent]float64, len(sim.agents))
+			for _, agent := range sim.agents {
+				if agent.energy > 0 {
+					before[agent] = agent.energy
+				}
+			}
+			if _, err := sim.Advance(1); err != nil {
+				t.Fatal(err)
+			}
+
+			change := 0.0
+			for agent, energy := range before {
+				change += agent.energy - energy
+				if agent.energy <= 0 {
+					deaths++
+				}
+			}
+			public := sim.summery[sim.iteration].Publish()
+			if math.Abs(public.GainedAll-public.SpentAll-change) > 1e-6 {
+				t.Errorf("seed %d, iteration %d: gained - spent = %v, energy change %v", seed, sim.iteration, public.GainedAll-public.SpentAll, change)
+			}
+			if public.GainedAll != public.IncomeDecomposition.All.Gained || public.SpentOrganizers != public.IncomeDecomposition.Organizers.Spent {
+				t.Errorf("seed %d, iteration %d: scalar totals differ from income_decomposition", seed, sim.iteration)
+			}
+		}
+		if deaths == 0 {
+			t.Errorf("seed %d: no agent died", seed)
+		}
+	}
+}
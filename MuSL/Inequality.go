@@ -0,0 +1,84 @@
+package MuSL
+
+import (
+	"math"
+	"slices"
+)
+
+// 分布の不平等の指標
+// 合計が 0 以下、または値がない場合はすべて 0 とする。
+type Inequality struct {
+	Gini       float64 // ジニ係数
+	Top10Share float64 // 上位 10% (少なくとも 1 人) が占める割合
+	Theil      float64 // タイル指数 (T)
+}
+
+// 0 以上の値の分布の不平等を計算する
+func MeasureInequality(values []float64) Inequality {
+	n := len(values)
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	if n == 0 || total <= 0 {
+		return Inequality{}
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	// G = 2 Σ i x_i / (n Σ x) - (n + 1) / n (x は昇順、i は 1 から)
+	weighted := 0.0
+	for i, value := range sorted {
+		weighted += float64(i+1) * value
+	}
+	gini := 2*weighted/(float64(n)*total) - float64(n+1)/float64(n)
+
+	top := 0.0
+	num_top := max(1, int(math.Ceil(float64(n)*0.1)))
+	for _, value := range sorted[n-num_top:] {
+		top += value
+	}
+
+	// T = (1/n) Σ (x/μ) ln(x/μ) (x = 0 の項は 0)
+	mean := total / float64(n)
+	theil := 0.0
+	for _, value := range sorted {
+		if value > 0 {
+			theil += value / mean * math.Log(value/mean)
+		}
+	}
+	theil /= float64(n)
+
+	return Inequality{
+		Gini:       gini,
+		Top10Share: top / total,
+		Theil:      theil,
+	}
+}
+
+// 生きているエージェントのエネルギーと、生きている作成者がそのイテレーションにイベントから得た報酬の不平等を計算する (8)
+func (s *Summery) CalculateInequality(agents []*Agent) {
+	energies := make([]float64, 0)
+	incomes := make([]float64, 0)
+	for _, agent := range agents {
+		// 生きているエージェントのみ
+		if agent.energy <= 0 {
+			continue
+		}
+		energies = append(energies, agent.energy)
+		if agent.role[0] {
+			incomes = append(incomes, agent.income.EventIncome())
+		}
+	}
+
+	energy := MeasureInequality(energies)
+	s.energy_gini = energy.Gini              // 8-1
+	s.energy_top10_share = energy.Top10Share // 8-2
+	s.energy_theil = energy.Theil            // 8-3
+
+	income := MeasureInequality(incomes)
+	s.income_gini = income.Gini              // 8-4
+	s.income_top10_share = income.Top10Share // 8-5
+	s.income_theil = income.Theil            // 8-6
+}
@@ -0,0 +1,44 @@
+package MuSL
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestMeasureInequality(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   Inequality
+	}{
+		{"empty", nil, Inequality{}},
+		{"all zero", []float64{0, 0, 0}, Inequality{}},
+		{"equal", []float64{1, 1, 1, 1}, Inequality{Gini: 0, Top10Share: 0.25, Theil: 0}},
+		{"one has all", []float64{0, 0, 0, 4}, Inequality{Gini: 0.75, Top10Share: 1, Theil: math.Log(4)}},
+		{"unsorted", []float64{4, 0, 0, 0}, Inequality{Gini: 0.75, Top10Share: 1, Theil: math.Log(4)}},
+		{"linear", []float64{1, 2, 3, 4}, Inequality{
+			Gini:       0.25,
+			Top10Share: 0.4,
+			Theil:      (0.4*math.Log(0.4) + 0.8*math.Log(0.8) + 1.2*math.Log(1.2) + 1.6*math.Log(1.6)) / 4,
+		}},
+		{"top two of eleven", []float64{1, 1, 1, 1, 1, 10, 1, 1, 1, 1, 1}, Inequality{
+			Gini:       1.5 - 12.0/11,
+			Top10Share: 11.0 / 20,
+			Theil:      (10*0.55*math.Log(0.55) + 5.5*math.Log(5.5)) / 11,
+		}},
+	}
+
+	for _, test := range tests {
+		values := slices.Clone(test.values)
+		got := MeasureInequality(values)
+		if math.Abs(got.Gini-test.want.Gini) > 1e-12 ||
+			math.Abs(got.Top10Share-test.want.Top10Share) > 1e-12 ||
+			math.Abs(got.Theil-test.want.Theil) > 1e-12 {
+			t.Errorf("%s: %+v, want %+v", test.name, got, test.want)
+		}
+		if !slices.Equal(values, test.values) {
+			t.Errorf("%s: values changed to %v", test.name, values)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package MuSL
+
+import (
+	"sort"
+)
+
+// ジャンル空間上の最近傍探索のための k-d 木
+// 次元は最初に挿入された曲のジャンルから決まる。
+// 削除は墓標を立てるだけにして、削除済みの節が生きている節より多くなったら作り直す。
+type KDTree struct {
+	root *kd_node
+	dim  int
+	live int // 生きている節の数
+	dead int // 削除済みの節の数
+}
+
+type kd_node struct {
+	song    *Song
+	axis    int
+	left    *kd_node
+	right   *kd_node
+	deleted bool
+}
+
+// 近傍探索の結果
+type Neighbor struct {
+	Song     *Song
+	Distance float64 // ジャンル間の二乗距離の平均 (Listener.Listen と同じ定義)
+}
+
+func MakeNewKDTree() *KDTree {
+	return &KDTree{}
+}
+
+func (t *KDTree) Len() int {
+	return t.live
+}
+
+// 曲を挿入し、削除に使う節を返す
+func (t *KDTree) Insert(song *Song) *kd_node {
+	if t.root == nil && t.dead == 0 {
+		t.dim = len(song.genre)
+	}
+	t.live++
+
+	if t.root == nil {
+		t.root = &kd_node{song: song, axis: 0}
+		return t.root
+	}
+
+	node := t.root
+	for {
+		child := &node.right
+		if song.genre[node.axis] < node.song.genre[node.axis] {
+			child = &node.left
+		}
+		if *child == nil {
+			*child = &kd_node{song: song, axis: (node.axis + 1) % t.dim}
+			return *child
+		}
+		node = *child
+	}
+}
+
+// Insert が返した節を削除する
+func (t *KDTree) Delete(node *kd_node) {
+	if node.deleted {
+		return
+	}
+	node.deleted = true
+	t.live--
+	t.dead++
+
+	if t.dead > t.live {
+		t.rebuild()
+	}
+}
+
+// 生きている節だけで釣り合った木を作り直す
+// 節は使い回すので、Insert が返した節はそのまま Delete に使える
+func (t *KDTree) rebuild() {
+	nodes := make([]*kd_node, 0, t.live)
+	var collect func(node *kd_node)
+	collect = func(node *kd_node) {
+		if node == nil {
+			return
+		}
+		if !node.deleted {
+			nodes = append(nodes, node)
+		}
+		collect(node.left)
+		collect(node.right)
+	}
+	collect(t.root)
+
+	t.root = t.build(nodes, 0)
+	t.dead = 0
+}
+
+func (t *KDTree) build(nodes []*kd_node, axis int) *kd_node {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	// 中央値で分割する (同じ値は右に寄せる)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].song.genre[axis] < nodes[j].song.genre[axis]
+	})
+	median := len(nodes) / 2
+	for median > 0 && nodes[median-1].song.genre[axis] == nodes[median].song.genre[axis] {
+		median--
+	}
+
+	node := nodes[median]
+	node.axis = axis
+	next := (axis + 1) % t.dim
+	node.left = t.build(nodes[:median], next)
+	node.right = t.build(nodes[median+1:], next)
+	return node
+}
+
+// 最も近い曲を返す。空の場合は ok = false。
+func (t *KDTree) Nearest(genre []float64) (Neighbor, bool) {
+	neighbors := t.KNearest(genre, 1)
+	if len(neighbors) == 0 {
+		return Neighbor{}, false
+	}
+	return neighbors[0], true
+}
+
+// 近い順に k 曲を返す
+func (t *KDTree) KNearest(genre []float64, k int) []Neighbor {
+	if k <= 0 || t.live == 0 {
+		return []Neighbor{}
+	}
+
+	// best は二乗距離の合計の昇順に並べる
+	best := make([]Neighbor, 0, k)
+	var search func(node *kd_node)
+	search = func(node *kd_node) {
+		if node == nil {
+			return
+		}
+
+		if !node.deleted {
+			distance := squared_distance(genre, node.song.genre)
+			if len(best) < k || distance < best[len(best)-1].Distance {
+				i := sort.Search(len(best), func(i int) bool { return best[i].Distance > distance })
+				if len(best) < k {
+					best = append(best, Neighbor{})
+				}
+				copy(best[i+1:], best[i:])
+				best[i] = Neighbor{node.song, distance}
+			}
+		}
+
+		diff := genre[node.axis] - node.song.genre[node.axis]
+		near, far := node.left, node.right
+		if diff >= 0 {
+			near, far = node.right, node.left
+		}
+
+		search(near)
+		// 分割面までの距離が現在の k 番目より遠ければ、反対側は探さない
+		if len(best) < k || diff*diff < best[len(best)-1].Distance {
+			search(far)
+		}
+	}
+	search(t.root)
+
+	for i := range best {
+		best[i].Distance /= float64(len(genre))
+	}
+	return best
+}
+
+// 二乗距離の合計 (Listener.Listen と同じ順序で足す)
+func squared_distance(a, b []float64) float64 {
+	distance := 0.0
+	for i := range a {
+		distance += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return distance
+}
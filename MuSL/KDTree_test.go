@@ -0,0 +1,114 @@
+package MuSL
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+func random_song(id, dim int, rng *rand.Rand) *Song {
+	genre := make([]float64, dim)
+	for i := range genre {
+		genre[i] = rng.Float64()
+	}
+	return &Song{id: id, genre: genre}
+}
+
+// k-d 木の最近傍探索は、挿入と削除 (作り直しを含む) を繰り返しても線形探索と同じ距離を返す
+func TestKDTreeMatchesLinear(t *testing.T) {
+	tests := []struct {
+		dim        int
+		operations int
+		delete     float64 // 削除する確率
+	}{
+		{1, 500, 0.3},
+		{2, 2000, 0.3},
+		{2, 2000, 0.6}, // 削除が多く、何度も作り直す
+		{3, 1000, 0.5},
+	}
+
+	for _, test := range tests {
+		rng := rand.New(rand.NewPCG(uint64(test.dim), uint64(test.operations)))
+		tree := MakeNewKDTree()
+		songs := make([]*Song, 0)
+		nodes := make([]*kd_node, 0)
+		rebuilds := 0
+
+		for op := range test.operations {
+			if len(songs) > 0 && rng.Float64() < test.delete {
+				i := rng.IntN(len(songs))
+				dead := tree.dead
+				tree.Delete(nodes[i])
+				if tree.dead < dead {
+					rebuilds++
+				}
+				songs = append(songs[:i], songs[i+1:]...)
+				nodes = append(nodes[:i], nodes[i+1:]...)
+			} else {
+				song := random_song(op, test.dim, rng)
+				songs = append(songs, song)
+				nodes = append(nodes, tree.Insert(song))
+			}
+
+			if tree.Len() != len(songs) {
+				t.Fatalf("dim %d, operation %d: Len %d, want %d", test.dim, op, tree.Len(), len(songs))
+			}
+
+			query := random_song(-1, test.dim, rng).genre
+			got, got_ok := tree.Nearest(query)
+			want, want_ok := LinearNearest(songs, query)
+			if got_ok != want_ok || got.Distance != want.Distance {
+				t.Fatalf("dim %d, operation %d: Nearest %v (%v), want %v (%v)", test.dim, op, got.Distance, got_ok, want.Distance, want_ok)
+			}
+
+			k := 1 + rng.IntN(5)
+			got_k := tree.KNearest(query, k)
+			want_k := LinearKNearest(songs, query, k)
+			if len(got_k) != len(want_k) {
+				t.Fatalf("dim %d, operation %d: KNearest returned %d songs, want %d", test.dim, op, len(got_k), len(want_k))
+			}
+			for i := range want_k {
+				if got_k[i].Distance != want_k[i].Distance {
+					t.Fatalf("dim %d, operation %d: KNearest[%d] %v, want %v", test.dim, op, i, got_k[i].Distance, want_k[i].Distance)
+				}
+			}
+		}
+
+		if test.delete >= 0.5 && rebuilds == 0 {
+			t.Errorf("dim %d: the tree was never rebuilt", test.dim)
+		}
+	}
+}
+
+func BenchmarkKDTreeNearest(b *testing.B) {
+	for _, n_songs := range []int{1000, 10000} {
+		rng := rand.New(rand.NewPCG(1, 2))
+		tree := MakeNewKDTree()
+		for i := range n_songs {
+			tree.Insert(random_song(i, 2, rng))
+		}
+
+		b.Run("songs="+strconv.Itoa(n_songs), func(b *testing.B) {
+			for range b.N {
+				tree.Nearest(random_song(-1, 2, rng).genre)
+			}
+		})
+	}
+}
+
+// BenchmarkKDTreeNearest と比べるための線形探索
+func BenchmarkLinearNearest(b *testing.B) {
+	for _, n_songs := range []int{1000, 10000} {
+		rng := rand.New(rand.NewPCG(1, 2))
+		songs := make([]*Song, n_songs)
+		for i := range songs {
+			songs[i] = random_song(i, 2, rng)
+		}
+
+		b.Run("songs="+strconv.Itoa(n_songs), func(b *testing.B) {
+			for range b.N {
+				LinearNearest(songs, random_song(-1, 2, rng).genre)
+			}
+		})
+	}
+}
@@ -2,19 +2,19 @@ package MuSL
 
 import (
 	"math"
-	"math/rand/v2"
 )
 
 type Listener struct {
 	novelty_preference    float64
-	memory                []*Song
+	memory                *SongMemory
 	incoming_songs        []*Song
 	song_events           []*Event
 	listening_probability float64
+	memory_retention      float64 // 記憶容量の遺伝子 (MemoryParams.evolvable のときのみ有効)
 	evaluation_cost       Const64
 }
 
-func (l *Listener) Listen(agents *[]*Agent, me *Agent, summery *Summery) {
+func (l *Listener) Listen(agents *[]*Agent, me *Agent, summery *Summery, effects *Effects) {
 	if len(l.incoming_songs) == 0 {
 		return
 	}
@@ -22,34 +22,28 @@ func (l *Listener) Listen(agents *[]*Agent, me *Agent, summery *Summery) {
 	// 順番に聴く
 	for i, song := range l.incoming_songs {
 		// 聴くかどうか
-		if rand.Float64() < l.listening_probability {
+		if me.rng.Float64() < l.listening_probability {
 			// 評価
-			// 最も近い曲を探す
+			// 最も近い曲を探す (索引があれば k-d 木で探す)
 			min_distance := 1.0
-			for _, memory_song := range l.memory {
-				distance := 0.0
-				for i := range song.genre {
-					distance += (song.genre[i] - memory_song.genre[i]) * (song.genre[i] - memory_song.genre[i])
-				}
-				distance = distance / float64(len(song.genre))
-				if distance < min_distance {
-					min_distance = distance
-				}
+			if nearest, ok := l.memory.Nearest(song.genre); ok && nearest.Distance < min_distance {
+				min_distance = nearest.Distance
 			}
 
 			// novelty preference によって評価
 			evaluation := 1 - math.Abs(min_distance-l.novelty_preference)/math.Sqrt(2) // 最大距離が sqrt(2) なので
 
-			// 評価をイベントに記録し、エネルギーに加算
-			l.song_events[i].evaluation_pool[song] = append(l.song_events[i].evaluation_pool[song], evaluation)
-			me.energy += evaluation
+			// 評価と報酬価格をイベントに記録する (曲の集計値も更新される)
+			effects.Evaluate(me, l.song_events[i], song, evaluation, float64(l.evaluation_cost))
 
-			// 報酬価格を支払う
-			l.song_events[i].evaluation_reward[song] += float64(l.evaluation_cost)
+			// 評価をエネルギーに加算し、報酬価格を支払う
+			me.energy += evaluation
 			me.energy -= float64(l.evaluation_cost)
+			me.income.EvaluationPayoff += evaluation
+			me.income.EvaluationFee += float64(l.evaluation_cost)
 
 			// 記憶に追加
-			l.memory = append(l.memory, song)
+			l.memory.Add(song, evaluation, l.memory_retention, me.rng)
 
 			// 集計 (II)
 			summery.num_evaluation_all++
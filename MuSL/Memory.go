@@ -0,0 +1,319 @@
+package MuSL
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+)
+
+// 記憶の忘却方針
+const (
+	ForgetNone       = "none"        // 忘却しない (容量は無制限)
+	ForgetFIFO       = "fifo"        // 最も古い曲から忘れる
+	ForgetRandom     = "random"      // ランダムに選んだ曲を忘れる
+	ForgetDecay      = "decay"       // 重みを指数的に減衰させ、重みが小さい曲から忘れる
+	ForgetLeastRated = "least_rated" // 評価が最も低い曲から忘れる
+)
+
+// decay で重みがこの値を下回った曲は、容量に関係なく忘れる
+const decay_forget_threshold = 0.01
+
+// 記憶の実験定数。Creator と Listener でそれぞれ持つ。
+type MemoryParams struct {
+	capacity   Const64 // 記憶できる曲数の上限 (0 なら無制限)
+	policy     string  // 忘却方針
+	decay_rate Const64 // decay の場合の 1 イテレーションあたりの減衰率
+	evolvable  bool    // true なら capacity に memory_retention 遺伝子を掛けたものを上限とする
+}
+
+func MakeMemoryParams(capacity int, policy string, decay_rate float64, evolvable bool) (*MemoryParams, error) {
+	switch policy {
+	case ForgetNone, ForgetFIFO, ForgetRandom, ForgetDecay, ForgetLeastRated:
+	default:
+		return nil, &MemoryPolicyError{policy}
+	}
+	if capacity < 0 {
+		return nil, &MemoryParamsError{"capacity", "must not be negative, got " + strconv.Itoa(capacity)}
+	}
+	if policy == ForgetNone && capacity > 0 {
+		return nil, &MemoryParamsError{"capacity", "must be 0 (unlimited) with the none policy, got " + strconv.Itoa(capacity)}
+	}
+	if decay_rate < 0 || decay_rate > 1 {
+		return nil, &MemoryParamsError{"decay_rate", "must be between 0 and 1, got " + strconv.FormatFloat(decay_rate, 'g', -1, 64)}
+	}
+
+	return &MemoryParams{
+		capacity:   Const64(capacity),
+		policy:     policy,
+		decay_rate: Const64(decay_rate),
+		evolvable:  evolvable,
+	}, nil
+}
+
+// 容量と忘却方針を持つ曲の記憶
+type SongMemory struct {
+	params  *MemoryParams
+	songs   []*Song
+	weights []float64 // decay では重み、least_rated では記憶したときの評価
+	index   *KDTree   // 最近傍探索用の索引 (nil なら索引を持たない)
+	nodes   []*kd_node
+}
+
+func MakeNewSongMemory(params *MemoryParams) *SongMemory {
+	return &SongMemory{
+		params:  params,
+		songs:   make([]*Song, 0),
+		weights: make([]float64, 0),
+		index:   nil,
+		nodes:   nil,
+	}
+}
+
+// 最近傍探索用の k-d 木を持つ記憶を作成する
+func MakeNewIndexedSongMemory(params *MemoryParams) *SongMemory {
+	m := MakeNewSongMemory(params)
+	m.index = MakeNewKDTree()
+	m.nodes = make([]*kd_node, 0)
+	return m
+}
+
+// 同じ実験定数を持つ空の記憶を作成する
+func (m *SongMemory) EmptyCopy() *SongMemory {
+	if m.index != nil {
+		return MakeNewIndexedSongMemory(m.params)
+	}
+	return MakeNewSongMemory(m.params)
+}
+
+func (m *SongMemory) Len() int {
+	return len(m.songs)
+}
+
+// 記憶している曲を返す (読み取り専用)
+func (m *SongMemory) Songs() []*Song {
+	return m.songs
+}
+
+// memory_retention 遺伝子で容量が変わるか
+func (m *SongMemory) Evolvable() bool {
+	return m.params.evolvable
+}
+
+// 容量が進化しない場合の memory_retention 遺伝子の値
+const fixed_memory_retention = 1.0
+
+// memory_retention 遺伝子の初期値。容量が進化しない場合は乱数を使わずに固定の値にする。
+func (m *SongMemory) randomRetention(rng *rand.Rand) float64 {
+	if !m.params.evolvable {
+		return fixed_memory_retention
+	}
+	return rng.Float64()
+}
+
+// retention (memory_retention 遺伝子) を考慮した容量を返す。0 なら無制限。
+func (m *SongMemory) Capacity(retention float64) int {
+	if m.params.policy == ForgetNone || m.params.capacity <= 0 {
+		return 0
+	}
+
+	capacity := float64(m.params.capacity)
+	if m.params.evolvable {
+		capacity = math.Round(capacity * retention)
+	}
+	return max(1, int(capacity))
+}
+
+// 曲を記憶し、容量を超えた分を忘れる。忘れた曲を返す。
+// rating は least_rated で使う評価で、NaN の場合は曲の平均評価を用いる。
+func (m *SongMemory) Add(song *Song, rating float64, retention float64, rng *rand.Rand) []*Song {
+	weight := 1.0
+	if m.params.policy == ForgetLeastRated {
+		weight = rating
+	}
+	m.songs = append(m.songs, song)
+	m.weights = append(m.weights, weight)
+	if m.index != nil {
+		m.nodes = append(m.nodes, m.index.Insert(song))
+	}
+
+	forgotten := make([]*Song, 0)
+	capacity := m.Capacity(retention)
+	for capacity > 0 && len(m.songs) > capacity {
+		forgotten = append(forgotten, m.remove(m.victim(rng)))
+	}
+	return forgotten
+}
+
+// 1 イテレーション分だけ重みを減衰させ、重みが閾値を下回った曲を忘れる。忘れた曲を返す。
+// decay 以外の方針では何もしない。
+func (m *SongMemory) Decay() []*Song {
+	forgotten := make([]*Song, 0)
+	if m.params.policy != ForgetDecay {
+		return forgotten
+	}
+
+	kept := 0
+	for i, song := range m.songs {
+		weight := m.weights[i] * (1.0 - float64(m.params.decay_rate))
+		if weight < decay_forget_threshold {
+			forgotten = append(forgotten, song)
+			if m.index != nil {
+				m.index.Delete(m.nodes[i])
+			}
+			continue
+		}
+		m.songs[kept] = song
+		m.weights[kept] = weight
+		if m.index != nil {
+			m.nodes[kept] = m.nodes[i]
+		}
+		kept++
+	}
+	clear(m.songs[kept:])
+	m.songs = m.songs[:kept]
+	m.weights = m.weights[:kept]
+	if m.index != nil {
+		clear(m.nodes[kept:])
+		m.nodes = m.nodes[:kept]
+	}
+
+	return forgotten
+}
+
+// 記憶からランダムに曲を選ぶ。decay では重みに比例した確率で選ぶ。
+// 記憶が空の場合は nil を返す。
+func (m *SongMemory) Sample(rng *rand.Rand) *Song {
+	if len(m.songs) == 0 {
+		return nil
+	}
+
+	if m.params.policy == ForgetDecay {
+		sum := 0.0
+		for _, weight := range m.weights {
+			sum += weight
+		}
+		r := rng.Float64() * sum
+		for i, weight := range m.weights {
+			r -= weight
+			if r < 0 {
+				return m.songs[i]
+			}
+		}
+		return m.songs[len(m.songs)-1]
+	}
+
+	return m.songs[rng.IntN(len(m.songs))]
+}
+
+// 忘却方針に従って、忘れる曲の位置を返す
+func (m *SongMemory) victim(rng *rand.Rand) int {
+	switch m.params.policy {
+	case ForgetRandom:
+		return rng.IntN(len(m.songs))
+	case ForgetDecay:
+		return argmin(len(m.songs), func(i int) float64 { return m.weights[i] })
+	case ForgetLeastRated:
+		return argmin(len(m.songs), m.rating)
+	default: // ForgetFIFO
+		return 0
+	}
+}
+
+// least_rated で用いる評価。
+// 記憶したときの評価がない場合は曲の平均評価を用い、まだ評価されていない曲は最後まで残す。
+func (m *SongMemory) rating(i int) float64 {
+	if !math.IsNaN(m.weights[i]) {
+		return m.weights[i]
+	}
+	stats := m.songs[i].stats
+	if stats.num_evaluations == 0 {
+		return math.Inf(1)
+	}
+	return stats.sum_evaluation / float64(stats.num_evaluations)
+}
+
+func (m *SongMemory) remove(i int) *Song {
+	song := m.songs[i]
+	m.songs = append(m.songs[:i], m.songs[i+1:]...)
+	m.weights = append(m.weights[:i], m.weights[i+1:]...)
+	if m.index != nil {
+		m.index.Delete(m.nodes[i])
+		m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+	}
+	return song
+}
+
+// genre に最も近い曲を返す。記憶が空の場合は ok = false。
+// 索引がある場合は k-d 木で、ない場合は線形探索で求める。距離はどちらも同じになる。
+func (m *SongMemory) Nearest(genre []float64) (Neighbor, bool) {
+	if m.index != nil {
+		return m.index.Nearest(genre)
+	}
+	return LinearNearest(m.songs, genre)
+}
+
+// genre に近い順に k 曲を返す
+func (m *SongMemory) KNearest(genre []float64, k int) []Neighbor {
+	if m.index != nil {
+		return m.index.KNearest(genre, k)
+	}
+	return LinearKNearest(m.songs, genre, k)
+}
+
+// 線形探索で genre に最も近い曲を返す
+func LinearNearest(songs []*Song, genre []float64) (Neighbor, bool) {
+	if len(songs) == 0 {
+		return Neighbor{}, false
+	}
+	nearest := Neighbor{songs[0], squared_distance(genre, songs[0].genre)}
+	for _, song := range songs[1:] {
+		if distance := squared_distance(genre, song.genre); distance < nearest.Distance {
+			nearest = Neighbor{song, distance}
+		}
+	}
+	nearest.Distance /= float64(len(genre))
+	return nearest, true
+}
+
+// 線形探索で genre に近い順に k 曲を返す
+func LinearKNearest(songs []*Song, genre []float64, k int) []Neighbor {
+	neighbors := make([]Neighbor, len(songs))
+	for i, song := range songs {
+		neighbors[i] = Neighbor{song, squared_distance(genre, song.genre) / float64(len(genre))}
+	}
+	sort.SliceStable(neighbors, func(i, j int) bool {
+		return neighbors[i].Distance < neighbors[j].Distance
+	})
+	return neighbors[:max(0, min(k, len(neighbors)))]
+}
+
+// f(i) が最小となる i を返す (同じ値なら古いものを優先)
+func argmin(n int, f func(int) float64) int {
+	min_index := 0
+	min_value := f(0)
+	for i := 1; i < n; i++ {
+		if value := f(i); value < min_value {
+			min_index = i
+			min_value = value
+		}
+	}
+	return min_index
+}
+
+type MemoryPolicyError struct {
+	policy string
+}
+
+func (e *MemoryPolicyError) Error() string {
+	return "Unknown memory policy: " + strconv.Quote(e.policy)
+}
+
+type MemoryParamsError struct {
+	name    string
+	message string
+}
+
+func (e *MemoryParamsError) Error() string {
+	return "Invalid memory " + e.name + ": " + e.message
+}
@@ -0,0 +1,244 @@
+package MuSL
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestMakeMemoryParams(t *testing.T) {
+	tests := []struct {
+		capacity   int
+		policy     string
+		decay_rate float64
+		ok         bool
+	}{
+		{0, ForgetNone, 0.1, true},
+		{10, ForgetFIFO, 0.1, true},
+		{0, ForgetRandom, 0.1, true},
+		{10, ForgetDecay, 0, true},
+		{10, ForgetDecay, 1, true},
+		{10, ForgetLeastRated, 0.5, true},
+		{-1, ForgetFIFO, 0.1, false},
+		{-1, ForgetNone, 0.1, false},
+		{10, ForgetNone, 0.1, false},
+		{10, ForgetDecay, -0.1, false},
+		{10, ForgetDecay, 1.5, false},
+		{10, "forget_everything", 0.1, false},
+	}
+
+	for _, test := range tests {
+		_, err := MakeMemoryParams(test.capacity, test.policy, test.decay_rate, false)
+		if test.ok && err != nil {
+			t.Errorf("MakeMemoryParams(%d, %q, %g): unexpected error: %v", test.capacity, test.policy, test.decay_rate, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("MakeMemoryParams(%d, %q, %g): no error", test.capacity, test.policy, test.decay_rate)
+		}
+	}
+}
+
+// 進化させない遺伝子は p1 の値を引き継ぎ、他の遺伝子の乱数の使い方も変えない
+func TestCrossoverAndMutateFrozen(t *testing.T) {
+	g1 := []float64{0.1, 0.2, 0.3, 0.4, 0.5}
+	g2 := []float64{0.9, 0.8, 0.7, 0.6, 0.5}
+	frozen := []bool{false, true, false, false, true}
+	params := MakeGAParams(0.5, 0.1)
+
+	for seed := range uint64(20) {
+		child := CrossoverAndMutate(g1, g2, params, frozen, rand.New(rand.NewPCG(seed, 0)))
+
+		// 進化させる遺伝子だけで交叉したものと一致する
+		free1 := []float64{g1[0], g1[2], g1[3]}
+		free2 := []float64{g2[0], g2[2], g2[3]}
+		free := CrossoverAndMutate(free1, free2, params, nil, rand.New(rand.NewPCG(seed, 0)))
+
+		if child[1] != g1[1] || child[4] != g1[4] {
+			t.Errorf("seed %d: frozen genes changed: %v", seed, child)
+		}
+		if child[0] != free[0] || child[2] != free[1] || child[3] != free[2] {
+			t.Errorf("seed %d: frozen genes used random numbers: %v, want %v", seed, child, free)
+		}
+	}
+}
+
+// 記憶の操作。id が負なら Decay、そうでなければ rating で Add する
+type memory_op struct {
+	id     int
+	rating float64
+}
+
+func song_ids_of(songs []*Song) []int {
+	ids := make([]int, len(songs))
+	for i, song := range songs {
+		ids[i] = song.id
+	}
+	return ids
+}
+
+// 容量を超えたとき、忘却方針に従った曲を忘れる
+func TestSongMemoryForget(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name       string
+		policy     string
+		decay_rate float64
+		ops        []memory_op
+		evaluated  map[int]float64 // 記憶したときの評価が NaN の曲の平均評価 (1 回評価されたとする)
+		forgotten  []int
+		kept       []int
+	}{
+		{"fifo", ForgetFIFO, 0.1, []memory_op{{1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}}, nil, []int{1, 2}, []int{3, 4, 5}},
+		{"least rated", ForgetLeastRated, 0.1, []memory_op{{1, 0.5}, {2, 0.1}, {3, 0.9}, {4, 0.7}}, nil, []int{2}, []int{1, 3, 4}},
+		{"least rated by average", ForgetLeastRated, 0.1,
+			[]memory_op{{1, nan}, {2, 0.3}, {3, nan}, {4, 0.6}},
+			map[int]float64{3: 0.2}, []int{3}, []int{1, 2, 4}},
+		{"least rated keeps unevaluated songs", ForgetLeastRated, 0.1,
+			[]memory_op{{1, nan}, {2, 0.3}, {3, 0.1}, {4, 0.6}}, nil, []int{3}, []int{1, 2, 4}},
+		{"decay", ForgetDecay, 0.5, []memory_op{{1, 0}, {-1, 0}, {2, 0}, {-1, 0}, {3, 0}, {4, 0}}, nil, []int{1}, []int{2, 3, 4}},
+		{"decay forgets the oldest weight", ForgetDecay, 0.1, []memory_op{{1, 0}, {2, 0}, {-1, 0}, {3, 0}, {4, 0}}, nil, []int{1}, []int{2, 3, 4}},
+	}
+
+	for _, test := range tests {
+		params, err := MakeMemoryParams(3, test.policy, test.decay_rate, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := MakeNewSongMemory(params)
+		rng := rand.New(rand.NewPCG(1, 0))
+
+		forgotten := make([]*Song, 0)
+		for _, op := range test.ops {
+			if op.id < 0 {
+				forgotten = append(forgotten, m.Decay()...)
+				continue
+			}
+			song := &Song{id: op.id, genre: []float64{0.5, 0.5}}
+			if average, ok := test.evaluated[op.id]; ok {
+				song.stats.num_evaluations = 1
+				song.stats.sum_evaluation = average
+			}
+			forgotten = append(forgotten, m.Add(song, op.rating, 1, rng)...)
+		}
+
+		if got := song_ids_of(forgotten); !slices.Equal(got, test.forgotten) {
+			t.Errorf("%s: forgot %v, want %v", test.name, got, test.forgotten)
+		}
+		if got := song_ids_of(m.Songs()); !slices.Equal(got, test.kept) {
+			t.Errorf("%s: kept %v, want %v", test.name, got, test.kept)
+		}
+	}
+}
+
+// random は rng で選んだ位置の曲を忘れ、同じ seed なら同じ曲を忘れる
+func TestSongMemoryForgetRandom(t *testing.T) {
+	params, err := MakeMemoryParams(3, ForgetRandom, 0.1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forgotten_ids := make(map[int]bool)
+	for seed := range uint64(20) {
+		m := MakeNewSongMemory(params)
+		rng := rand.New(rand.NewPCG(seed, 0))
+		for id := 1; id <= 3; id++ {
+			if forgotten := m.Add(&Song{id: id}, 0, 1, rng); len(forgotten) != 0 {
+				t.Fatalf("seed %d: forgot %v below the capacity", seed, song_ids_of(forgotten))
+			}
+		}
+
+		// 4 曲目を入れた後の 4 曲から rng.IntN(4) の位置を忘れる
+		want := 1 + rand.New(rand.NewPCG(seed, 0)).IntN(4)
+		forgotten := m.Add(&Song{id: 4}, 0, 1, rng)
+		if got := song_ids_of(forgotten); !slices.Equal(got, []int{want}) {
+			t.Errorf("seed %d: forgot %v, want [%d]", seed, got, want)
+		}
+		if m.Len() != 3 {
+			t.Errorf("seed %d: %d songs after forgetting", seed, m.Len())
+		}
+		forgotten_ids[want] = true
+	}
+	if len(forgotten_ids) < 2 {
+		t.Errorf("random always forgot the same position: %v", forgotten_ids)
+	}
+}
+
+// Decay は重みを decay_rate だけ減らし、閾値を下回った曲を忘れる
+func TestSongMemoryDecay(t *testing.T) {
+	params, err := MakeMemoryParams(0, ForgetDecay, 0.5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := MakeNewSongMemory(params)
+	rng := rand.New(rand.NewPCG(1, 0))
+	m.Add(&Song{id: 1}, 0, 1, rng)
+
+	weight := 1.0
+	for step := 1; step <= 7; step++ {
+		if step == 4 {
+			m.Add(&Song{id: 2}, 0, 1, rng)
+		}
+		forgotten := m.Decay()
+		weight *= 0.5
+
+		// 1/128 < decay_forget_threshold なので、7 回目で曲 1 を忘れる
+		if weight < decay_forget_threshold {
+			if got := song_ids_of(forgotten); !slices.Equal(got, []int{1}) {
+				t.Errorf("step %d: forgot %v, want [1]", step, got)
+			}
+			break
+		}
+		if len(forgotten) != 0 {
+			t.Errorf("step %d: forgot %v", step, song_ids_of(forgotten))
+		}
+		if math.Abs(m.weights[0]-weight) > 1e-12 {
+			t.Errorf("step %d: weight %v, want %v", step, m.weights[0], weight)
+		}
+	}
+	if got := song_ids_of(m.Songs()); !slices.Equal(got, []int{2}) {
+		t.Errorf("kept %v, want [2]", got)
+	}
+	if math.Abs(m.weights[0]-0.0625) > 1e-12 {
+		t.Errorf("weight of song 2 is %v, want 0.0625", m.weights[0])
+	}
+
+	// decay 以外の方針では何もしない
+	fifo, _ := MakeMemoryParams(0, ForgetFIFO, 0.5, false)
+	other := MakeNewSongMemory(fifo)
+	other.Add(&Song{id: 1}, 0, 1, rng)
+	if forgotten := other.Decay(); len(forgotten) != 0 || other.weights[0] != 1 {
+		t.Errorf("fifo: Decay forgot %v, weight %v", song_ids_of(forgotten), other.weights[0])
+	}
+}
+
+// memory_retention は進化させる場合だけ容量に掛かる
+func TestSongMemoryCapacity(t *testing.T) {
+	tests := []struct {
+		capacity  int
+		policy    string
+		evolvable bool
+		retention float64
+		want      int
+	}{
+		{10, ForgetFIFO, true, 1, 10},
+		{10, ForgetFIFO, true, 0.5, 5},
+		{10, ForgetFIFO, true, 0.26, 3},
+		{10, ForgetFIFO, true, 0, 1}, // 少なくとも 1 曲
+		{10, ForgetFIFO, false, 0.5, 10},
+		{10, ForgetFIFO, false, 0, 10},
+		{0, ForgetFIFO, true, 0.5, 0}, // 無制限
+		{0, ForgetNone, true, 0.5, 0},
+	}
+
+	for _, test := range tests {
+		params, err := MakeMemoryParams(test.capacity, test.policy, 0.1, test.evolvable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := MakeNewSongMemory(params).Capacity(test.retention); got != test.want {
+			t.Errorf("capacity %d, %s, evolvable %v, retention %g: %d, want %d",
+				test.capacity, test.policy, test.evolvable, test.retention, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package MuSL
+
+// シミュレーションの途中経過を受け取るためのインターフェース
+// Simulation.AddObserver で登録する。
+// 通知はシミュレーションと同じ goroutine から、副作用が適用された順に行われる。
+// 引数の Song, Event, Agent は読み取り専用として扱うこと。
+// OnAgentDied は、エネルギーが 0 以下になったイテレーションの終わり (OnIterationEnd の前) に通知される。
+type SimulationObserver interface {
+	OnIterationStart(iteration int)
+	OnIterationEnd(summery *PublicSummery)
+	OnSongCreated(song *Song)
+	OnSongEvaluated(listener *Agent, event *Event, song *Song, evaluation float64)
+	OnEventOpened(organizer *Agent, event *Event)
+	OnEventSettled(organizer *Agent, event *Event)
+	OnPayout(event *Event, song *Song, reward float64, won_major bool)
+	OnAgentBorn(child, parent, spouse *Agent)
+	OnAgentDied(agent *Agent)
+}
+
+// 何もしない SimulationObserver
+// 埋め込んで、必要なメソッドだけを実装するために使う
+type NopObserver struct{}
+
+func (NopObserver) OnIterationStart(iteration int)                                                {}
+func (NopObserver) OnIterationEnd(summery *PublicSummery)                                         {}
+func (NopObserver) OnSongCreated(song *Song)                                                      {}
+func (NopObserver) OnSongEvaluated(listener *Agent, event *Event, song *Song, evaluation float64) {}
+func (NopObserver) OnEventOpened(organizer *Agent, event *Event)                                  {}
+func (NopObserver) OnEventSettled(organizer *Agent, event *Event)                                 {}
+func (NopObserver) OnPayout(event *Event, song *Song, reward float64, won_major bool)             {}
+func (NopObserver) OnAgentBorn(child, parent, spouse *Agent)                                      {}
+func (NopObserver) OnAgentDied(agent *Agent)                                                      {}
+
+// 以下は、パッケージの外の SimulationObserver から読むためのアクセサ
+
+func (s *Song) ID() int            { return s.id }
+func (s *Song) ParentID() int      { return s.parent_id }
+func (s *Song) Iteration() int     { return s.iteration }
+func (s *Song) CreatorID() int     { return s.creator_id }
+func (s *Song) Genre() []float64   { return append([]float64{}, s.genre...) }
+func (a *Agent) ID() int           { return a.id }
+func (a *Agent) Energy() float64   { return a.energy }
+func (a *Agent) Role() []bool      { return append([]bool{}, a.role...) }
+func (a *Agent) Gene() []float64   { return a.ToGene() }
+func (e *Event) ID() int           { return e.id }
+func (e *Event) OrganizerID() int  { return e.organizer_id }
+func (e *Event) Iteration() int    { return e.iteration }
+func (e *Event) Type() string      { return e.event_type }
+func (e *Event) NumSongs() int     { return len(e.creator_pool) }
+func (e *Event) NumListeners() int { return len(e.listener_pool) }
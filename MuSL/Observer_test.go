@@ -0,0 +1,67 @@
+package MuSL
+
+import (
+	"testing"
+)
+
+// 死亡の通知を記録する SimulationObserver
+type death_recorder struct {
+	NopObserver
+	iteration int
+	died      map[*Agent]int // 通知されたイテレーション
+	ended     bool           // OnIterationEnd の後に通知されたか
+}
+
+func (r *death_recorder) OnIterationStart(iteration int) {
+	r.iteration = iteration
+}
+
+func (r *death_recorder) OnIterationEnd(summery *PublicSummery) {
+	r.iteration = -1
+}
+
+func (r *death_recorder) OnAgentDied(agent *Agent) {
+	if r.iteration < 0 {
+		r.ended = true
+	}
+	r.died[agent] = r.iteration
+}
+
+// 死んだエージェントは、最後のイテレーションで死んだ場合も含めて、そのイテレーションのうちに 1 度だけ通知される
+func TestOnAgentDiedInSameIteration(t *testing.T) {
+	for _, seed := range []int64{2, 7, 13} {
+		c := test_config(ScheduleFixed, seed)
+		sim, err := c.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+		recorder := &death_recorder{iteration: -1, died: make(map[*Agent]int)}
+		sim.AddObserver(recorder)
+
+		// 死んだイテレーションの終わりにはまだ s.agents に残っているので、1 イテレーションずつ確かめる
+		for sim.Iteration() < sim.NumIterations() {
+			if _, err := sim.Advance(1); err != nil {
+				t.Fatal(err)
+			}
+			for _, agent := range sim.agents {
+				iteration, ok := recorder.died[agent]
+				if agent.energy <= 0 && !ok {
+					t.Errorf("seed %d, iteration %d: agent %d died without a notification", seed, sim.Iteration(), agent.id)
+				}
+				if agent.energy > 0 && ok {
+					t.Errorf("seed %d: agent %d notified as dead while alive", seed, agent.id)
+				}
+				if ok && agent.energy <= 0 && iteration > sim.Iteration() {
+					t.Errorf("seed %d: agent %d notified in iteration %d, after %d", seed, agent.id, iteration, sim.Iteration())
+				}
+			}
+		}
+		if recorder.ended {
+			t.Errorf("seed %d: OnAgentDied after OnIterationEnd", seed)
+		}
+		if len(recorder.died) == 0 {
+			t.Errorf("seed %d: no agent died; the test does not check anything", seed)
+		}
+	}
+}
@@ -1,17 +1,30 @@
 package MuSL
 
 import (
-	"math/rand/v2"
 	"sort"
+	"sync/atomic"
 )
 
+// イベントの ID を管理するためのグローバル変数
+var global_event_id_counter atomic.Int64
+
+func GetNewEventID() int {
+	return int(global_event_id_counter.Add(1))
+}
+
 // Readonly
 type Event struct {
-	event_type        string
-	creator_pool      []*Song
-	listener_pool     []*Agent
-	evaluation_pool   map[*Song][]float64
-	evaluation_reward map[*Song]float64
+	id                  int // 開催を適用したときに振られる
+	organizer_id        int
+	iteration           int // 開催されたイテレーション
+	event_type          string
+	creator_pool        []*Song
+	listener_pool       []*Agent
+	evaluation_pool     map[*Song][]float64
+	evaluation_reward   map[*Song]float64
+	num_recommendations int     // リスナーに届いたおすすめの数
+	fee                 float64 // 精算時の中抜き
+	organizer_income    float64 // 精算時に運営者が受け取った額
 }
 
 type Organizer struct {
@@ -38,17 +51,20 @@ type Organizer struct {
 	minor_recommendation_ratio Const64 // リスナーに曲をおすすめする確率
 }
 
-func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
+func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery, effects *Effects) {
 	// 前回のイベントの報酬を支払う
+	// 同じ seed で同じ結果になるよう、map ではなく creator_pool の順に曲を扱う
 	for _, event := range o.created_events {
 		// イベントの報酬を支払う
+		fee_sum := 0.0
+		organizer_income := 0.0
 
 		if event.event_type == "major" {
 
 			// 合計報酬を計算
 			reward_sum := 0.0
-			for _, reward := range event.evaluation_reward {
-				reward_sum += reward
+			for _, song := range event.creator_pool {
+				reward_sum += event.evaluation_reward[song]
 			}
 
 			// 最初に中抜きを行う
@@ -56,6 +72,9 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 
 			reward_sum -= fee
 			me.energy += reward_sum
+			me.income.OrganizerFee += reward_sum
+			fee_sum += fee
+			organizer_income += reward_sum
 
 			// 曲を平均評価値でソート
 			// 平均評価値の計算
@@ -65,7 +84,8 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 			}
 
 			song_evaluations := make([]SongEvaluation, 0)
-			for song, evaluations := range event.evaluation_pool {
+			for _, song := range event.creator_pool {
+				evaluations := event.evaluation_pool[song]
 				sum := 0.0
 				for _, evaluation := range evaluations {
 					sum += evaluation
@@ -84,37 +104,60 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 			bonus := reward_sum * float64(o.major_reward_ratio) / float64(num_winners)
 
 			for _, song_evaluation := range song_evaluations[:num_winners] {
-				song := song_evaluation.song
-				song.creator.energy += bonus
+				effects.Reward(event, song_evaluation.song, bonus, PayoutMajorBonus)
+
+				// 集計 (III)
+				summery.winner_payout += bonus
+				summery.major_payout += bonus
 			}
 
 			// 全ての曲に報酬を与える
 			each_reward := reward_sum * (1.0 - float64(o.major_reward_ratio)) / float64(len(song_evaluations))
-			for _, song_evaluation := range song_evaluations {
-				song := song_evaluation.song
-				song.creator.energy += each_reward
+			for k, song_evaluation := range song_evaluations {
+				effects.Reward(event, song_evaluation.song, each_reward, PayoutFlatShare)
+
+				// 集計 (III)
+				if k < num_winners {
+					summery.winner_payout += each_reward
+				}
+				summery.major_payout += each_reward
 			}
 		} else {
 			// マイナーイベント
 			// マイナーイベントでは、最初に一定割合の報酬を還元
 			reward_sum := 0.0
 
-			for song, reward := range event.evaluation_reward {
+			for _, song := range event.creator_pool {
+				reward := event.evaluation_reward[song]
+
 				// 中抜き
 				fee := reward * float64(o.organization_reward)
 				reward -= fee
 				me.energy += reward
+				me.income.OrganizerFee += reward
+				fee_sum += fee
+				organizer_income += reward
 
 				// 一定割合を還元
 				reward_return := reward * float64(o.minor_reward_ratio)
-				song.creator.energy += reward_return
+				effects.Reward(event, song, reward_return, PayoutMinorRebate)
 				reward_sum += reward - reward_return
 			}
 
 			// 全ての曲に報酬を与える
 			each_reward := reward_sum / float64(len(event.evaluation_reward))
-			for song := range event.evaluation_reward {
-				song.creator.energy += each_reward
+			for _, song := range event.creator_pool {
+				effects.Reward(event, song, each_reward, PayoutFlatShare)
+			}
+		}
+
+		effects.SettleEvent(me, event, fee_sum, organizer_income)
+
+		// 集計 (III)
+		summery.num_settled_songs += len(event.creator_pool)
+		for _, song := range event.creator_pool {
+			if len(event.evaluation_pool[song]) > 0 {
+				summery.num_evaluated_songs++
 			}
 		}
 	}
@@ -122,7 +165,7 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 	// イベントをすべて削除
 	o.created_events = make([]*Event, 0)
 
-	if rand.Float64() < o.event_probability {
+	if me.rng.Float64() < o.event_probability {
 		// イベントを生成
 		event_type := ""
 		creator_pool := make([]*Song, 0)
@@ -132,21 +175,21 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 
 		creators := make([]*Agent, 0)
 
-		if rand.Float64() < float64(o.major_probability) {
+		if me.rng.Float64() < float64(o.major_probability) {
 			// メジャーイベント
 			event_type = "major"
 			for _, agent := range *agents {
-				if agent.role[0] && rand.Float64() < float64(o.major_creator_ratio) {
+				if agent.role[0] && me.rng.Float64() < float64(o.major_creator_ratio) {
 					creators = append(creators, agent)
 				}
-				if agent.role[1] && rand.Float64() < float64(o.major_listener_ratio) {
+				if agent.role[1] && me.rng.Float64() < float64(o.major_listener_ratio) {
 					listener_pool = append(listener_pool, agent)
 				}
 			}
 
 			for _, creator := range creators {
-				for _, song := range creator.creator.memory {
-					if rand.Float64() < float64(o.major_song_ratio) {
+				for _, song := range creator.creator.memory.Songs() {
+					if me.rng.Float64() < float64(o.major_song_ratio) {
 						creator_pool = append(creator_pool, song)
 					}
 				}
@@ -155,17 +198,17 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 			// マイナーイベント
 			event_type = "minor"
 			for _, agent := range *agents {
-				if agent.role[0] && rand.Float64() < float64(o.minor_creator_ratio) {
+				if agent.role[0] && me.rng.Float64() < float64(o.minor_creator_ratio) {
 					creators = append(creators, agent)
 				}
-				if agent.role[1] && rand.Float64() < float64(o.minor_listener_ratio) {
+				if agent.role[1] && me.rng.Float64() < float64(o.minor_listener_ratio) {
 					listener_pool = append(listener_pool, agent)
 				}
 			}
 
 			for _, creator := range creators {
-				for _, song := range creator.creator.memory {
-					if rand.Float64() < float64(o.minor_song_ratio) {
+				for _, song := range creator.creator.memory.Songs() {
+					if me.rng.Float64() < float64(o.minor_song_ratio) {
 						creator_pool = append(creator_pool, song)
 					}
 				}
@@ -174,22 +217,29 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 
 		// イベントを生成
 		event := &Event{
-			event_type:        event_type,
-			creator_pool:      creator_pool,
-			listener_pool:     listener_pool,
-			evaluation_pool:   evaluation_pool,
-			evaluation_reward: evaluation_reward,
+			organizer_id:        me.id,
+			iteration:           summery.iteration,
+			event_type:          event_type,
+			creator_pool:        creator_pool,
+			listener_pool:       listener_pool,
+			evaluation_pool:     evaluation_pool,
+			evaluation_reward:   evaluation_reward,
+			num_recommendations: 0,
+			fee:                 0,
+			organizer_income:    0,
 		}
 
 		o.created_events = append(o.created_events, event)
 
 		// 開催コストを支払う
 		me.energy -= float64(o.organization_cost)
+		me.income.OrganizationCost += float64(o.organization_cost)
 
 		// イベントの報酬を設定
 		for _, song := range creator_pool {
 			event.evaluation_pool[song] = make([]float64, 0)
 			event.evaluation_reward[song] = 0.0
+			effects.EnterEvent(song)
 		}
 
 		// 評価は次のイテレーションまでに集められるため、
@@ -204,18 +254,28 @@ func (o *Organizer) Organize(agents *[]*Agent, me *Agent, summery *Summery) {
 					recommendation_ratio = float64(o.minor_recommendation_ratio)
 				}
 
-				if rand.Float64() < recommendation_ratio {
-					// リスナーに曲をおすすめ
-					listener.listener.incoming_songs = append(listener.listener.incoming_songs, song)
-					// イベントも登録
-					listener.listener.song_events = append(listener.listener.song_events, event)
+				if me.rng.Float64() < recommendation_ratio {
+					// リスナーに曲をおすすめし、イベントも登録
+					effects.Recommend(listener, song, event)
+
+					// 集計 (III)
+					summery.num_recommendation_this++
 				}
 			}
 		}
 
+		effects.OpenEvent(me, event)
+
 		// 集計 (III)
 		summery.num_event_all++
 		summery.num_event_this++
+		if event_type == "major" {
+			summery.num_major_event_this++
+		} else {
+			summery.num_minor_event_this++
+		}
+		summery.event_num_songs = append(summery.event_num_songs, len(creator_pool))
+		summery.event_num_listeners = append(summery.event_num_listeners, len(listener_pool))
 
 	}
 }
@@ -0,0 +1,43 @@
+package MuSL
+
+// 楽曲の系統樹のノード
+// 各曲は Creator.Create で memory の曲から派生するため、派生元を親とする木構造になる。
+// ランダムに生成された曲が根になる。
+type PhylogenyNode struct {
+	ID               int              `json:"id"`
+	ParentID         int              `json:"parent_id"` // 根の場合は -1
+	Iteration        int              `json:"iteration"`
+	ExtinctIteration int              `json:"extinct_iteration"` // 残っている場合は -1
+	CreatorID        int              `json:"creator_id"`
+	Genre            []float64        `json:"genre"`
+	Children         []*PhylogenyNode `json:"children"`
+}
+
+// 楽曲のリストから系統樹を構築し、根のリストを返す
+// songs は作成順に並んでいるものとする
+func BuildPhylogeny(songs []*Song) []*PhylogenyNode {
+	nodes := make(map[int]*PhylogenyNode, len(songs))
+	roots := make([]*PhylogenyNode, 0)
+
+	for _, song := range songs {
+		node := &PhylogenyNode{
+			ID:               song.id,
+			ParentID:         song.parent_id,
+			Iteration:        song.iteration,
+			ExtinctIteration: song.extinct_iteration,
+			CreatorID:        song.creator_id,
+			Genre:            song.genre,
+			Children:         make([]*PhylogenyNode, 0),
+		}
+		nodes[song.id] = node
+
+		// 親は必ず先に作成されている
+		if parent, ok := nodes[song.parent_id]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,395 @@
+package MuSL
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// グラフの大きさと余白 (px)。右の余白には凡例を置く。
+const (
+	plot_width         = 720
+	plot_height        = 440
+	plot_margin_left   = 70
+	plot_margin_right  = 200
+	plot_margin_top    = 40
+	plot_margin_bottom = 50
+)
+
+// 系列の色。すべてのグラフで同じものには同じ色を使う。
+const (
+	ColorTotal     = "#444444"
+	ColorCreator   = "#1f77b4"
+	ColorListener  = "#ff7f0e"
+	ColorOrganizer = "#2ca02c"
+	ColorMajor     = "#d62728"
+	ColorMinor     = "#9467bd"
+	ColorSong      = "#393b79"
+)
+
+// 遺伝子の色 (GeneNames の順、役割の遺伝子を除く)
+var gene_colors = []string{
+	"#8c564b",
+	"#e377c2",
+	"#7f7f7f",
+	"#bcbd22",
+	"#17becf",
+	"#637939",
+	"#8c6d31",
+	"#843c39",
+}
+
+// 折れ線グラフの系列。NaN の点では線を切る。
+type PlotSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+// 折れ線グラフ。各系列の Values は X と同じ長さ。
+type LineChart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	X      []float64
+	Series []PlotSeries
+}
+
+// 散布図。Points の各点の先頭 2 次元を描く。
+type ScatterChart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	Color  string
+	Points [][]float64
+	XMin   float64
+	XMax   float64
+	YMin   float64
+	YMax   float64
+}
+
+type PlotIterationError struct {
+	Iteration int
+}
+
+func (e *PlotIterationError) Error() string {
+	return "no genre snapshot at iteration " + strconv.Itoa(e.Iteration)
+}
+
+// サマリーから SVG のグラフを dir に書き出し、書き出したファイル名を返す
+// ジャンルの散布図は iteration のスナップショットを使う。iteration が負の場合は最後のスナップショットを使い、スナップショットがなければ散布図だけを省く。
+// iteration のスナップショットがない場合も、散布図以外のグラフは書き出してからエラーを返す。
+func PlotSummeries(dir string, summeries []*PublicSummery, iteration int) ([]string, error) {
+	x := make([]float64, len(summeries))
+	for i, summery := range summeries {
+		x[i] = float64(summery.Iteration)
+	}
+	series := func(name, color string, value func(*PublicSummery) float64) PlotSeries {
+		values := make([]float64, len(summeries))
+		for i, summery := range summeries {
+			values[i] = value(summery)
+		}
+		return PlotSeries{Name: name, Color: color, Values: values}
+	}
+
+	charts := map[string]*LineChart{
+		"population.svg": {
+			Title: "Population by role", XLabel: "iteration", YLabel: "agents", X: x,
+			Series: []PlotSeries{
+				series("all", ColorTotal, func(s *PublicSummery) float64 { return float64(s.NumPopulation) }),
+				series("creators", ColorCreator, func(s *PublicSummery) float64 { return float64(s.NumCreaters) }),
+				series("listeners", ColorListener, func(s *PublicSummery) float64 { return float64(s.NumListeners) }),
+				series("organizers", ColorOrganizer, func(s *PublicSummery) float64 { return float64(s.NumOrganizers) }),
+			},
+		},
+		"energy.svg": {
+			Title: "Energy by role", XLabel: "iteration", YLabel: "energy", X: x,
+			Series: []PlotSeries{
+				series("all", ColorTotal, func(s *PublicSummery) float64 { return s.TotalEnergy }),
+				series("creators", ColorCreator, func(s *PublicSummery) float64 { return s.EnergyCreators }),
+				series("listeners", ColorListener, func(s *PublicSummery) float64 { return s.EnergyListeners }),
+				series("organizers", ColorOrganizer, func(s *PublicSummery) float64 { return s.EnergyOrganizers }),
+			},
+		},
+		"genes.svg": {
+			Title: "Average genes", XLabel: "iteration", YLabel: "mean", X: x,
+			Series: gene_series(summeries, series),
+		},
+		"events.svg": {
+			Title: "Events per iteration", XLabel: "iteration", YLabel: "events", X: x,
+			Series: []PlotSeries{
+				series("all", ColorTotal, func(s *PublicSummery) float64 { return float64(s.NumEventThis) }),
+				series("major", ColorMajor, func(s *PublicSummery) float64 { return float64(s.NumMajorEventThis) }),
+				series("minor", ColorMinor, func(s *PublicSummery) float64 { return float64(s.NumMinorEventThis) }),
+			},
+		},
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(charts)+1)
+	for _, name := range []string{"population.svg", "energy.svg", "genes.svg", "events.svg"} {
+		file_name := filepath.Join(dir, name)
+		if err := write_svg_file(file_name, charts[name].WriteSVG); err != nil {
+			return files, err
+		}
+		files = append(files, file_name)
+	}
+
+	// ジャンルのスナップショット
+	// 折れ線グラフは書き出したまま、散布図だけを省くかエラーにする
+	snapshot := find_genre_snapshot(summeries, iteration)
+	if snapshot == nil {
+		if iteration < 0 {
+			// スナップショットを取らなかったサマリー
+			return files, nil
+		}
+		return files, &PlotIterationError{iteration}
+	}
+	genres, err := snapshot.Genres()
+	if err != nil {
+		return files, err
+	}
+	scatter := &ScatterChart{
+		Title:  "Genres at iteration " + strconv.Itoa(snapshot.Iteration),
+		XLabel: "genre[0]",
+		YLabel: "genre[1]",
+		Color:  ColorSong,
+		Points: genres,
+		XMin:   0,
+		XMax:   1,
+		YMin:   0,
+		YMax:   1,
+	}
+	file_name := filepath.Join(dir, "genres_"+strconv.Itoa(snapshot.Iteration)+".svg")
+	if err := write_svg_file(file_name, scatter.WriteSVG); err != nil {
+		return files, err
+	}
+	return append(files, file_name), nil
+}
+
+// 遺伝子の平均の系列。gene_distribution がない古いサマリーでは avg_innovation と avg_novelty_preference を使う。
+func gene_series(summeries []*PublicSummery, series func(string, string, func(*PublicSummery) float64) PlotSeries) []PlotSeries {
+	has_distribution := false
+	for _, summery := range summeries {
+		if summery.GeneDistribution != nil {
+			has_distribution = true
+			break
+		}
+	}
+	if !has_distribution {
+		return []PlotSeries{
+			series("innovation", gene_colors[1], func(s *PublicSummery) float64 { return s.AvgInnovation }),
+			series("novelty_preference", gene_colors[4], func(s *PublicSummery) float64 { return s.AvgNoveltyPreference }),
+		}
+	}
+
+	// 役割の遺伝子は population.svg に現れるので除く
+	list := make([]PlotSeries, 0, GeneLength-3)
+	for g := 3; g < GeneLength; g++ {
+		list = append(list, series(GeneNames[g], gene_colors[g-3], func(s *PublicSummery) float64 {
+			// 最初のイテレーションには分布がない
+			if s.GeneDistribution == nil || len(s.GeneDistribution.All) <= g {
+				return math.NaN()
+			}
+			return s.GeneDistribution.All[g].Mean
+		}))
+	}
+	return list
+}
+
+// iteration のジャンルのスナップショットを探す。見つからなければ nil を返す。
+func find_genre_snapshot(summeries []*PublicSummery, iteration int) *PublicSummery {
+	var found *PublicSummery
+	for _, summery := range summeries {
+		if len(summery.AllGenres) == 0 && summery.GenresCompact == "" {
+			continue
+		}
+		if iteration < 0 || summery.Iteration == iteration {
+			found = summery
+		}
+	}
+	return found
+}
+
+func write_svg_file(file_name string, write func(io.Writer) error) error {
+	file, err := os.Create(file_name)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// 折れ線グラフを SVG で書き出す
+func (c *LineChart) WriteSVG(w io.Writer) error {
+	x_min, x_max := math.Inf(1), math.Inf(-1)
+	for _, x := range c.X {
+		x_min, x_max = math.Min(x_min, x), math.Max(x_max, x)
+	}
+	// 縦軸は 0 を含める
+	y_min, y_max := 0.0, math.Inf(-1)
+	for _, series := range c.Series {
+		for _, y := range series.Values {
+			if !math.IsNaN(y) && !math.IsInf(y, 0) {
+				y_min, y_max = math.Min(y_min, y), math.Max(y_max, y)
+			}
+		}
+	}
+
+	var b strings.Builder
+	area := begin_plot(&b, c.Title, c.XLabel, c.YLabel, x_min, x_max, y_min, y_max)
+
+	for _, series := range c.Series {
+		// NaN で区切られた区間ごとに 1 本の線を引く
+		points := make([]string, 0, len(c.X))
+		flush := func() {
+			if len(points) > 1 {
+				b.WriteString(`<polyline fill="none" stroke-width="1.5" stroke="` + series.Color + `" points="` + strings.Join(points, " ") + `"/>` + "\n")
+			}
+			points = points[:0]
+		}
+		for i, y := range series.Values {
+			if i >= len(c.X) || math.IsNaN(y) || math.IsInf(y, 0) {
+				flush()
+				continue
+			}
+			points = append(points, format_px(area.px(c.X[i]))+","+format_px(area.py(y)))
+		}
+		flush()
+	}
+
+	// 凡例
+	for i, series := range c.Series {
+		y := plot_margin_top + 10 + i*20
+		x := plot_width - plot_margin_right + 20
+		b.WriteString(`<line x1="` + strconv.Itoa(x) + `" y1="` + strconv.Itoa(y) + `" x2="` + strconv.Itoa(x+20) + `" y2="` + strconv.Itoa(y) + `" stroke-width="2" stroke="` + series.Color + `"/>` + "\n")
+		b.WriteString(`<text x="` + strconv.Itoa(x+26) + `" y="` + strconv.Itoa(y+4) + `">` + escape_svg(series.Name) + `</text>` + "\n")
+	}
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// 散布図を SVG で書き出す
+func (c *ScatterChart) WriteSVG(w io.Writer) error {
+	var b strings.Builder
+	area := begin_plot(&b, c.Title, c.XLabel, c.YLabel, c.XMin, c.XMax, c.YMin, c.YMax)
+
+	b.WriteString(`<g fill="` + c.Color + `" fill-opacity="0.6">` + "\n")
+	for _, point := range c.Points {
+		if len(point) < 2 {
+			continue
+		}
+		b.WriteString(`<circle r="2" cx="` + format_px(area.px(point[0])) + `" cy="` + format_px(area.py(point[1])) + `"/>` + "\n")
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString(`<text x="` + strconv.Itoa(plot_width-plot_margin_right+20) + `" y="` + strconv.Itoa(plot_margin_top+14) + `">` + strconv.Itoa(len(c.Points)) + ` songs</text>` + "\n")
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// 描画領域の座標変換
+type plot_area struct {
+	x_min, x_max float64
+	y_min, y_max float64
+}
+
+func (a *plot_area) px(x float64) float64 {
+	width := float64(plot_width - plot_margin_left - plot_margin_right)
+	return plot_margin_left + (x-a.x_min)/(a.x_max-a.x_min)*width
+}
+
+func (a *plot_area) py(y float64) float64 {
+	height := float64(plot_height - plot_margin_top - plot_margin_bottom)
+	return plot_height - plot_margin_bottom - (y-a.y_min)/(a.y_max-a.y_min)*height
+}
+
+// SVG の先頭、タイトル、軸、目盛り、軸ラベルを書き、座標変換を返す
+// 範囲は目盛りの切りのよい値まで広げる。
+func begin_plot(b *strings.Builder, title, x_label, y_label string, x_min, x_max, y_min, y_max float64) *plot_area {
+	x_min, x_max, x_step := nice_range(x_min, x_max)
+	y_min, y_max, y_step := nice_range(y_min, y_max)
+	area := &plot_area{x_min, x_max, y_min, y_max}
+
+	left, right := plot_margin_left, plot_width-plot_margin_right
+	top, bottom := plot_margin_top, plot_height-plot_margin_bottom
+
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="` + strconv.Itoa(plot_width) + `" height="` + strconv.Itoa(plot_height) + `" font-family="sans-serif" font-size="12">` + "\n")
+	b.WriteString(`<rect width="100%" height="100%" fill="white"/>` + "\n")
+	b.WriteString(`<text x="` + strconv.Itoa((left+right)/2) + `" y="24" text-anchor="middle" font-size="16">` + escape_svg(title) + `</text>` + "\n")
+
+	// 目盛りと補助線
+	for i := 0; x_min+float64(i)*x_step <= x_max+x_step/2; i++ {
+		x := x_min + float64(i)*x_step
+		px := format_px(area.px(x))
+		b.WriteString(`<line x1="` + px + `" y1="` + strconv.Itoa(top) + `" x2="` + px + `" y2="` + strconv.Itoa(bottom) + `" stroke="#e0e0e0"/>` + "\n")
+		b.WriteString(`<text x="` + px + `" y="` + strconv.Itoa(bottom+16) + `" text-anchor="middle">` + format_tick(x, x_step) + `</text>` + "\n")
+	}
+	for i := 0; y_min+float64(i)*y_step <= y_max+y_step/2; i++ {
+		y := y_min + float64(i)*y_step
+		py := format_px(area.py(y))
+		b.WriteString(`<line x1="` + strconv.Itoa(left) + `" y1="` + py + `" x2="` + strconv.Itoa(right) + `" y2="` + py + `" stroke="#e0e0e0"/>` + "\n")
+		b.WriteString(`<text x="` + strconv.Itoa(left-6) + `" y="` + py + `" text-anchor="end" dominant-baseline="middle">` + format_tick(y, y_step) + `</text>` + "\n")
+	}
+
+	// 軸
+	b.WriteString(`<rect x="` + strconv.Itoa(left) + `" y="` + strconv.Itoa(top) + `" width="` + strconv.Itoa(right-left) + `" height="` + strconv.Itoa(bottom-top) + `" fill="none" stroke="black"/>` + "\n")
+	b.WriteString(`<text x="` + strconv.Itoa((left+right)/2) + `" y="` + strconv.Itoa(plot_height-10) + `" text-anchor="middle">` + escape_svg(x_label) + `</text>` + "\n")
+	b.WriteString(`<text transform="translate(16,` + strconv.Itoa((top+bottom)/2) + `) rotate(-90)" text-anchor="middle">` + escape_svg(y_label) + `</text>` + "\n")
+
+	return area
+}
+
+// [lo, hi] を 1, 2, 5 × 10^k の目盛りで 5 つ程度に分ける範囲と目盛りの間隔
+func nice_range(lo, hi float64) (float64, float64, float64) {
+	if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+		lo, hi = 0, 1
+	}
+	if hi <= lo {
+		hi = lo + 1
+	}
+
+	raw := (hi - lo) / 5
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude * 10
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			step = m * magnitude
+			break
+		}
+	}
+	return math.Floor(lo/step) * step, math.Ceil(hi/step) * step, step
+}
+
+// 目盛りの値を、間隔に合わせた桁数で書く
+func format_tick(value, step float64) string {
+	digits := max(0, int(-math.Floor(math.Log10(step))))
+	value = math.Round(value/step) * step
+	if value == 0 {
+		value = 0 // -0 を避ける
+	}
+	return strconv.FormatFloat(value, 'f', digits, 64)
+}
+
+func format_px(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
+
+func escape_svg(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package MuSL
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// スナップショットがなくても折れ線グラフは書き出し、散布図だけを省くかエラーにする
+func TestPlotSummeriesWithoutSnapshot(t *testing.T) {
+	line_charts := []string{"population.svg", "energy.svg", "genes.svg", "events.svg"}
+	with_snapshot := []*PublicSummery{
+		{Iteration: 0},
+		{Iteration: 1, GenresCompact: EncodeGenres([][]float64{{0.1, 0.2}})},
+		{Iteration: 2},
+	}
+	without_snapshot := []*PublicSummery{{Iteration: 0}, {Iteration: 1}}
+
+	tests := []struct {
+		name      string
+		summeries []*PublicSummery
+		iteration int
+		scatter   string // 空なら散布図を書き出さない
+		ok        bool
+	}{
+		{"last snapshot", with_snapshot, -1, "genres_1.svg", true},
+		{"given snapshot", with_snapshot, 1, "genres_1.svg", true},
+		{"missing iteration", with_snapshot, 2, "", false},
+		{"no snapshot", without_snapshot, -1, "", true},
+		{"no snapshot at iteration", without_snapshot, 0, "", false},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		files, err := PlotSummeries(dir, test.summeries, test.iteration)
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+
+		want := slices.Clone(line_charts)
+		if test.scatter != "" {
+			want = append(want, test.scatter)
+		}
+		if len(files) != len(want) {
+			t.Errorf("%s: wrote %v, want %v", test.name, files, want)
+			continue
+		}
+		for i, name := range want {
+			if files[i] != filepath.Join(dir, name) {
+				t.Errorf("%s: wrote %v, want %v", test.name, files, want)
+				break
+			}
+			if _, err := os.Stat(files[i]); err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		}
+	}
+}
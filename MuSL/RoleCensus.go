@@ -0,0 +1,92 @@
+package MuSL
+
+import (
+	"sort"
+	"strings"
+)
+
+// 役割の組み合わせ。役割のないエージェントは初期状態にのみ現れる (子供は FromGene で失敗する)。
+var RoleCombinations = []string{
+	"creator",
+	"listener",
+	"organizer",
+	"creator+listener",
+	"creator+organizer",
+	"listener+organizer",
+	"creator+listener+organizer",
+	"none",
+}
+
+var role_names = [3]string{"creator", "listener", "organizer"}
+
+// role の組み合わせの名前 (例: "creator+listener")。役割がない場合は "none"。
+func RoleCombination(role []bool) string {
+	names := make([]string, 0, len(role))
+	for r, has_role := range role {
+		if has_role {
+			names = append(names, role_names[r])
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
+
+// 役割の組み合わせごとの人数とエネルギーの総量
+type RoleCount struct {
+	Count  int     `json:"count"`
+	Energy float64 `json:"energy"`
+}
+
+// 親の役割の組み合わせから子の役割の組み合わせへの遷移の数
+// 子供 1 人につき、両親それぞれからの遷移を 1 回ずつ数える
+type RoleTransition struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+	Count  int    `json:"count"`
+}
+
+type role_transition_key struct {
+	parent string
+	child  string
+}
+
+// すべての組み合わせを 0 で初期化した人数の表
+func make_role_census() map[string]RoleCount {
+	census := make(map[string]RoleCount, len(RoleCombinations))
+	for _, combination := range RoleCombinations {
+		census[combination] = RoleCount{}
+	}
+	return census
+}
+
+// 子供の誕生を集計する (V)
+func (s *Summery) CountBirth(child, parent, spouse *Agent) {
+	child_combination := RoleCombination(child.role)
+	s.role_transitions[role_transition_key{RoleCombination(parent.role), child_combination}]++
+	s.role_transitions[role_transition_key{RoleCombination(spouse.role), child_combination}]++
+}
+
+// 遷移の数を親、子の順に並べたリストにする
+func publish_role_transitions(transitions map[role_transition_key]int) []RoleTransition {
+	list := make([]RoleTransition, 0, len(transitions))
+	for key, count := range transitions {
+		list = append(list, RoleTransition{key.parent, key.child, count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Parent != list[j].Parent {
+			return list[i].Parent < list[j].Parent
+		}
+		return list[i].Child < list[j].Child
+	})
+	return list
+}
+
+func load_role_transitions(list []RoleTransition) map[role_transition_key]int {
+	transitions := make(map[role_transition_key]int, len(list))
+	for _, transition := range list {
+		transitions[role_transition_key{transition.Parent, transition.Child}] = transition.Count
+	}
+	return transitions
+}
@@ -0,0 +1,89 @@
+package MuSL
+
+import (
+	"strconv"
+)
+
+// エージェントの実行順序の方針
+const (
+	ScheduleFixed       = "fixed"       // スライスの順 (作成された順)
+	ScheduleRandom      = "random"      // イテレーションごとにランダムな順
+	ScheduleRolePhased  = "role"        // 全員が聴取してから全員が作曲し、その後全員がイベントを開催する
+	ScheduleSynchronous = "synchronous" // 段階ごとに全員が同時に行動し、副作用は段階の終わりに適用する
+)
+
+// 1 イテレーション分のエージェントの実行を行う
+// agents は生きているエージェント、生まれた子供は new_born_pool に入れる
+// 並列実行 (Simulation.SetParallel) をするかどうかで結果が変わらないよう、
+// 同時に行動させてよいエージェントの組は Simulation.runPhase で実行する。
+type Scheduler interface {
+	Schedule(s *Simulation, agents, new_born_pool *[]*Agent, summery *Summery)
+}
+
+// name の方針の Scheduler を作成する
+func MakeScheduler(name string) (Scheduler, error) {
+	switch name {
+	case ScheduleFixed:
+		return &FixedScheduler{}, nil
+	case ScheduleRandom:
+		return &RandomScheduler{}, nil
+	case ScheduleRolePhased:
+		return &RolePhasedScheduler{}, nil
+	case ScheduleSynchronous:
+		return &SynchronousScheduler{}, nil
+	default:
+		return nil, &SchedulerError{name}
+	}
+}
+
+// スライスの順に、エージェントごとにすべての段階を行う (従来の実行)
+// 前のエージェントの副作用を見て行動するので、並列実行でも 1 人ずつ実行する
+type FixedScheduler struct{}
+
+func (*FixedScheduler) Schedule(s *Simulation, agents, new_born_pool *[]*Agent, summery *Summery) {
+	effects := MakeImmediateEffects(new_born_pool, s.observers)
+	for _, agent := range *agents {
+		agent.Run(agents, s.ga_params, s.default_agent_params, summery, effects)
+	}
+}
+
+// イテレーションごとにランダムな順に、エージェントごとにすべての段階を行う
+type RandomScheduler struct{}
+
+func (*RandomScheduler) Schedule(s *Simulation, agents, new_born_pool *[]*Agent, summery *Summery) {
+	effects := MakeImmediateEffects(new_born_pool, s.observers)
+	for _, j := range s.rng.Perm(len(*agents)) {
+		(*agents)[j].Run(agents, s.ga_params, s.default_agent_params, summery, effects)
+	}
+}
+
+// 段階ごとに、スライスの順に全エージェントを実行する
+// 副作用はすぐに適用されるので、同じイテレーションで開催されたイベントの曲は次のイテレーションで聴かれる
+type RolePhasedScheduler struct{}
+
+func (*RolePhasedScheduler) Schedule(s *Simulation, agents, new_born_pool *[]*Agent, summery *Summery) {
+	effects := MakeImmediateEffects(new_born_pool, s.observers)
+	for phase := range NumPhases {
+		for _, agent := range *agents {
+			agent.RunPhase(phase, agents, s.ga_params, s.default_agent_params, summery, effects)
+		}
+	}
+}
+
+// 段階ごとに全エージェントが同時に行動する
+// 他のエージェントへの副作用は段階の終わりにエージェントの順に適用するので、同じ段階の他のエージェントの行動は見えない。
+type SynchronousScheduler struct{}
+
+func (*SynchronousScheduler) Schedule(s *Simulation, agents, new_born_pool *[]*Agent, summery *Summery) {
+	for phase := range NumPhases {
+		s.runPhase(phase, agents, new_born_pool, summery)
+	}
+}
+
+type SchedulerError struct {
+	name string
+}
+
+func (e *SchedulerError) Error() string {
+	return "Unknown scheduler: " + strconv.Quote(e.name)
+}
@@ -0,0 +1,93 @@
+package MuSL
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// 設定どおりにシミュレーションを実行し、サマリーを JSON で返す
+// ID はプロセス全体の通し番号なので比べられないが、サマリーには含まれない
+func run_summery_json(t *testing.T, c *SimulationConfig) string {
+	t.Helper()
+
+	sim, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	if err := sim.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(sim.GetSummery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func test_config(scheduler string, seed int64) *SimulationConfig {
+	c := DefaultSimulationConfig()
+	c.NumAgents = 40
+	c.NumIterations = 30
+	c.Seed = seed
+	c.Scheduler = scheduler
+	return c
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	tests := []struct {
+		scheduler string
+		workers   int
+	}{
+		{ScheduleSynchronous, 1},
+		{ScheduleSynchronous, 3},
+		{ScheduleSynchronous, 8},
+	}
+
+	for _, test := range tests {
+		for _, seed := range []int64{1, 7, 42} {
+			sequential := run_summery_json(t, test_config(test.scheduler, seed))
+
+			c := test_config(test.scheduler, seed)
+			c.Parallel = true
+			c.Workers = test.workers
+			parallel := run_summery_json(t, c)
+
+			if parallel != sequential {
+				t.Errorf("scheduler %s, workers %d, seed %d: parallel run differs from the sequential run", test.scheduler, test.workers, seed)
+			}
+		}
+	}
+}
+
+func TestSchedulerDeterministic(t *testing.T) {
+	for _, scheduler := range []string{ScheduleFixed, ScheduleRandom, ScheduleRolePhased, ScheduleSynchronous} {
+		first := run_summery_json(t, test_config(scheduler, 3))
+		second := run_summery_json(t, test_config(scheduler, 3))
+		if first != second {
+			t.Errorf("scheduler %s: two runs with the same seed differ", scheduler)
+		}
+	}
+}
+
+// 並列実行は synchronous でのみ使える
+func TestParallelRequiresSynchronous(t *testing.T) {
+	for _, scheduler := range []string{ScheduleFixed, ScheduleRandom, ScheduleRolePhased, ScheduleSynchronous} {
+		c := test_config(scheduler, 1)
+		c.Parallel = true
+		err := c.Validate()
+		if scheduler == ScheduleSynchronous && err != nil {
+			t.Errorf("scheduler %s: unexpected error: %v", scheduler, err)
+		}
+		if scheduler != ScheduleSynchronous && err == nil {
+			t.Errorf("scheduler %s: parallel was accepted", scheduler)
+		}
+	}
+}
+
+func TestMakeSchedulerUnknown(t *testing.T) {
+	if _, err := MakeScheduler("sideways"); err == nil {
+		t.Error("MakeScheduler accepted an unknown policy")
+	}
+}
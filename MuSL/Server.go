@@ -0,0 +1,363 @@
+package MuSL
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// 複数のシミュレーションを HTTP/JSON で作成し、進め、参照するサーバー
+// シミュレーションごとに独立して進められる (同時に進めてもよい)。
+//
+//	POST   /simulations                        設定 (SimulationConfig、省略した項目は既定値) から作成する
+//	GET    /simulations                        一覧
+//	GET    /simulations/{id}                   状態
+//	POST   /simulations/{id}/advance?n=N       N イテレーション進める。wait=true なら終わるまで待って返す
+//	POST   /simulations/{id}/pause             進めている途中なら、そのイテレーションが終わったところで止める
+//	GET    /simulations/{id}/summaries?since=N イテレーションが N より後のサマリー
+//	GET    /simulations/{id}/agents            生きているエージェントの一覧
+//	GET    /simulations/{id}/agents/{agent_id} エージェント
+//	GET    /simulations/{id}/songs             生きている曲 (生きている作成者の memory にある曲) の一覧
+//	DELETE /simulations/{id}                   止めて削除する
+type SimulationServer struct {
+	mu          sync.Mutex
+	simulations map[int]*managed_simulation
+	next_id     int
+	mux         *http.ServeMux
+}
+
+// サーバーが管理する 1 つのシミュレーション
+// sim は mu で守る。進めている間は、1 イテレーションごとに mu を取り直すので、その合間に参照できる。
+type managed_simulation struct {
+	id     int
+	config *SimulationConfig
+
+	mu      sync.Mutex
+	sim     *Simulation
+	running bool          // バックグラウンドで進めているか
+	pause   bool          // 止めるように頼まれたか
+	target  int           // 進める先のイテレーション
+	done    chan struct{} // 進めている goroutine が終わると閉じる
+	err     error         // 進めている途中で起きたエラー
+}
+
+// シミュレーションの状態
+type SimulationStatus struct {
+	ID            int               `json:"id"`
+	Config        *SimulationConfig `json:"config"`
+	Iteration     int               `json:"iteration"`
+	NumIterations int               `json:"num_iterations"`
+	Running       bool              `json:"running"`
+	Target        int               `json:"target"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// 生きているエージェントの状態
+type AgentInfo struct {
+	ID              int             `json:"id"`
+	Role            []bool          `json:"role"`
+	RoleCombination string          `json:"role_combination"`
+	Energy          float64         `json:"energy"`
+	Gene            []float64       `json:"gene"` // ToGene の順 (GeneNames)
+	CreatorMemory   int             `json:"creator_memory"`
+	ListenerMemory  int             `json:"listener_memory"`
+	Income          IncomeBreakdown `json:"income"` // 最後のイテレーションのエネルギーの増減
+}
+
+// 生きている曲。楽曲カタログの項目にジャンルと派生元を加えたもの
+type SongInfo struct {
+	*CatalogEntry
+	ParentID int       `json:"parent_id"`
+	Genre    []float64 `json:"genre"`
+}
+
+func MakeSimulationServer() *SimulationServer {
+	server := &SimulationServer{
+		simulations: make(map[int]*managed_simulation),
+		next_id:     1,
+		mux:         http.NewServeMux(),
+	}
+	server.mux.HandleFunc("POST /simulations", server.create)
+	server.mux.HandleFunc("GET /simulations", server.list)
+	server.mux.HandleFunc("GET /simulations/{id}", server.with_simulation(server.status))
+	server.mux.HandleFunc("POST /simulations/{id}/advance", server.with_simulation(server.advance))
+	server.mux.HandleFunc("POST /simulations/{id}/pause", server.with_simulation(server.pause))
+	server.mux.HandleFunc("GET /simulations/{id}/summaries", server.with_simulation(server.summaries))
+	server.mux.HandleFunc("GET /simulations/{id}/agents", server.with_simulation(server.agents))
+	server.mux.HandleFunc("GET /simulations/{id}/agents/{agent_id}", server.with_simulation(server.agent))
+	server.mux.HandleFunc("GET /simulations/{id}/songs", server.with_simulation(server.songs))
+	server.mux.HandleFunc("DELETE /simulations/{id}", server.with_simulation(server.remove))
+	return server
+}
+
+func (server *SimulationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+func (server *SimulationServer) create(w http.ResponseWriter, r *http.Request) {
+	config := DefaultSimulationConfig()
+	if err := ReadSimulationConfig(r.Body, config); err != nil {
+		write_api_error(w, http.StatusBadRequest, "invalid config: "+err.Error())
+		return
+	}
+
+	sim, err := config.Build()
+	if err != nil {
+		write_api_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sim.SetVerbose(false)
+
+	server.mu.Lock()
+	ms := &managed_simulation{
+		id:     server.next_id,
+		config: config,
+		sim:    sim,
+		done:   make(chan struct{}),
+	}
+	close(ms.done) // 進めていない
+	server.simulations[ms.id] = ms
+	server.next_id++
+	server.mu.Unlock()
+
+	write_api_json(w, http.StatusCreated, ms.status())
+}
+
+func (server *SimulationServer) list(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	list := make([]*managed_simulation, 0, len(server.simulations))
+	for _, ms := range server.simulations {
+		list = append(list, ms)
+	}
+	server.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	statuses := make([]SimulationStatus, len(list))
+	for i, ms := range list {
+		statuses[i] = ms.status()
+	}
+	write_api_json(w, http.StatusOK, statuses)
+}
+
+// パスの {id} のシミュレーションを探して handler に渡す
+func (server *SimulationServer) with_simulation(handler func(http.ResponseWriter, *http.Request, *managed_simulation)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			write_api_error(w, http.StatusBadRequest, "invalid simulation id: "+strconv.Quote(r.PathValue("id")))
+			return
+		}
+
+		server.mu.Lock()
+		ms, ok := server.simulations[id]
+		server.mu.Unlock()
+		if !ok {
+			write_api_error(w, http.StatusNotFound, "simulation not found: "+strconv.Itoa(id))
+			return
+		}
+		handler(w, r, ms)
+	}
+}
+
+func (server *SimulationServer) status(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	write_api_json(w, http.StatusOK, ms.status())
+}
+
+func (server *SimulationServer) advance(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 0 {
+		write_api_error(w, http.StatusBadRequest, "n must be a non-negative integer")
+		return
+	}
+
+	ms.mu.Lock()
+	if ms.running {
+		ms.mu.Unlock()
+		write_api_error(w, http.StatusConflict, "simulation is already running")
+		return
+	}
+	ms.running = true
+	ms.pause = false
+	ms.err = nil
+	ms.target = min(ms.sim.Iteration()+n, ms.sim.NumIterations())
+	ms.done = make(chan struct{})
+	done := ms.done
+	ms.mu.Unlock()
+
+	go ms.run()
+
+	if r.URL.Query().Get("wait") == "true" {
+		<-done
+		write_api_json(w, http.StatusOK, ms.status())
+		return
+	}
+	write_api_json(w, http.StatusAccepted, ms.status())
+}
+
+func (server *SimulationServer) pause(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	ms.stop()
+	write_api_json(w, http.StatusOK, ms.status())
+}
+
+func (server *SimulationServer) summaries(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	since := -1
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.Atoi(value); err != nil {
+			write_api_error(w, http.StatusBadRequest, "invalid since: "+strconv.Quote(value))
+			return
+		}
+	}
+
+	ms.mu.Lock()
+	summeries := make([]*PublicSummery, 0)
+	for _, summery := range ms.sim.summery {
+		if summery != nil && summery.iteration > since {
+			summeries = append(summeries, summery.Publish())
+		}
+	}
+	ms.mu.Unlock()
+
+	write_api_json(w, http.StatusOK, summeries)
+}
+
+func (server *SimulationServer) agents(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	ms.mu.Lock()
+	agents := make([]*AgentInfo, 0, len(ms.sim.agents))
+	for _, agent := range ms.sim.agents {
+		// 生きているエージェントのみ
+		if agent.energy > 0 {
+			agents = append(agents, make_agent_info(agent))
+		}
+	}
+	ms.mu.Unlock()
+
+	write_api_json(w, http.StatusOK, agents)
+}
+
+func (server *SimulationServer) agent(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	id, err := strconv.Atoi(r.PathValue("agent_id"))
+	if err != nil {
+		write_api_error(w, http.StatusBadRequest, "invalid agent id: "+strconv.Quote(r.PathValue("agent_id")))
+		return
+	}
+
+	ms.mu.Lock()
+	var info *AgentInfo
+	for _, agent := range ms.sim.agents {
+		if agent.id == id && agent.energy > 0 {
+			info = make_agent_info(agent)
+			break
+		}
+	}
+	ms.mu.Unlock()
+
+	if info == nil {
+		write_api_error(w, http.StatusNotFound, "agent not found: "+strconv.Itoa(id))
+		return
+	}
+	write_api_json(w, http.StatusOK, info)
+}
+
+func (server *SimulationServer) songs(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	ms.mu.Lock()
+	songs := make([]*Song, 0)
+	for _, agent := range ms.sim.agents {
+		// 生きているエージェントのみ
+		if agent.energy > 0 {
+			songs = append(songs, agent.creator.memory.Songs()...)
+		}
+	}
+	catalog := BuildSongCatalog(songs)
+	infos := make([]*SongInfo, len(songs))
+	for i, song := range songs {
+		infos[i] = &SongInfo{catalog[i], song.parent_id, append([]float64{}, song.genre...)}
+	}
+	ms.mu.Unlock()
+
+	write_api_json(w, http.StatusOK, infos)
+}
+
+func (server *SimulationServer) remove(w http.ResponseWriter, r *http.Request, ms *managed_simulation) {
+	ms.stop()
+
+	server.mu.Lock()
+	delete(server.simulations, ms.id)
+	server.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// target まで、または止めるように頼まれるまで 1 イテレーションずつ進める
+func (ms *managed_simulation) run() {
+	for {
+		ms.mu.Lock()
+		if ms.pause || ms.err != nil || ms.sim.Iteration() >= ms.target {
+			ms.running = false
+			ms.pause = false
+			close(ms.done)
+			ms.mu.Unlock()
+			return
+		}
+		_, ms.err = ms.sim.Advance(1)
+		ms.mu.Unlock()
+	}
+}
+
+// 進めている途中なら止めて、止まるまで待つ
+func (ms *managed_simulation) stop() {
+	ms.mu.Lock()
+	if ms.running {
+		ms.pause = true
+	}
+	done := ms.done
+	ms.mu.Unlock()
+
+	<-done
+}
+
+func (ms *managed_simulation) status() SimulationStatus {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	status := SimulationStatus{
+		ID:            ms.id,
+		Config:        ms.config,
+		Iteration:     ms.sim.Iteration(),
+		NumIterations: ms.sim.NumIterations(),
+		Running:       ms.running,
+		Target:        ms.target,
+	}
+	if ms.err != nil {
+		status.Error = ms.err.Error()
+	}
+	return status
+}
+
+func make_agent_info(agent *Agent) *AgentInfo {
+	// エージェントの内訳には合計が入っていないので、加算して計算する
+	var income IncomeBreakdown
+	income.add(&agent.income)
+	return &AgentInfo{
+		ID:              agent.id,
+		Role:            append([]bool{}, agent.role...),
+		RoleCombination: RoleCombination(agent.role),
+		Energy:          agent.energy,
+		Gene:            agent.ToGene(),
+		CreatorMemory:   agent.creator.memory.Len(),
+		ListenerMemory:  agent.listener.memory.Len(),
+		Income:          income,
+	}
+}
+
+func write_api_json(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func write_api_error(w http.ResponseWriter, code int, message string) {
+	write_api_json(w, code, map[string]string{"error": message})
+}
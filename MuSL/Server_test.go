@@ -0,0 +1,34 @@
+package MuSL
+
+import (
+	"math"
+	"testing"
+)
+
+// エージェントの情報の収入と支出の合計は、内訳の合計と一致する
+func TestAgentInfoIncomeTotals(t *testing.T) {
+	sim, err := test_config(ScheduleFixed, 4).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.SetVerbose(false)
+	if _, err := sim.Advance(10); err != nil {
+		t.Fatal(err)
+	}
+
+	active := 0
+	for _, agent := range sim.agents {
+		b := make_agent_info(agent).Income
+		gained := b.EvaluationPayoff + b.OrganizerFee + b.MajorBonus + b.FlatShare + b.MinorRebate
+		spent := b.EvaluationFee + b.CreationCost + b.OrganizationCost + b.ReproductionCost
+		if math.Abs(b.Gained-gained) > 1e-9 || math.Abs(b.Spent-spent) > 1e-9 {
+			t.Errorf("agent %d: gained %v, spent %v, want %v and %v", agent.id, b.Gained, b.Spent, gained, spent)
+		}
+		if spent > 0 {
+			active++
+		}
+	}
+	if active == 0 {
+		t.Error("no agent spent energy")
+	}
+}
@@ -1,27 +1,93 @@
 package MuSL
 
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync"
+)
+
 // シミュレーションの骨格
 type Simulation struct {
 	agents               []*Agent
 	n_iter               int
+	iteration            int // 終了したイテレーションの数 (再開時は 0 から始まらない)
 	ga_params            *GAParams
 	default_agent_params *Agent
 	summery              []*Summery
+	songs                []*Song // いままで作成されたすべての楽曲 (系統樹用)
+
+	seed uint64
+	src  *rand.PCG
+	rng  *rand.Rand
+
+	// エージェントの実行順序
+	scheduler Scheduler
+
+	// 並列実行の設定
+	// parallel が true なら、同時に行動するエージェントの組 (runPhase) を workers 個の goroutine で実行する。
+	// 副作用はエージェントの順に適用するので、parallel と workers によらず同じ結果になる。
+	parallel bool
+	workers  int
+
+	// 途中経過の通知先
+	observers []SimulationObserver
+
+	// ジャンルのスナップショットの取り方と、間引き用の乱数生成器
+	// シミュレーション本体の乱数とは分けて、スナップショットの設定で結果が変わらないようにする
+	genre_snapshot *GenreSnapshotParams
+	snapshot_src   *rand.PCG
+	snapshot_rng   *rand.Rand
+
+	// 多様性の指標を計算するときに、ジャンル空間の各軸を何等分するか
+	diversity_grid int
+
+	// false なら、最新のサマリー以外は捨てる (ストリーム出力で十分な場合のメモリ節約)
+	retain_summery bool
+
+	// checkpoint_every イテレーションごとに checkpoint_file に状態を保存する (0 なら保存しない)
+	checkpoint_file  string
+	checkpoint_every int
+
+	// 初期状態のサマリーを通知したか
+	started bool
+
+	// false なら、イテレーションごとの進み具合を表示しない
+	verbose bool
 }
 
 // 新しいシミュレーションを作成
-func MakeNewSimulation(n_agents, n_iter int, ga_params *GAParams, default_agent_params *Agent) *Simulation {
+func MakeNewSimulation(n_agents, n_iter int, seed uint64, ga_params *GAParams, default_agent_params *Agent) *Simulation {
+	src := rand.NewPCG(seed, 0)
+	snapshot_src := rand.NewPCG(seed, 1)
 	sim := &Simulation{
 		agents:               make([]*Agent, n_agents),
 		n_iter:               n_iter,
+		iteration:            0,
 		ga_params:            ga_params,
 		default_agent_params: default_agent_params,
 		summery:              make([]*Summery, n_iter+1),
+		songs:                make([]*Song, 0),
+		seed:                 seed,
+		src:                  src,
+		rng:                  rand.New(src),
+		scheduler:            &FixedScheduler{},
+		parallel:             false,
+		workers:              1,
+		observers:            make([]SimulationObserver, 0),
+		genre_snapshot:       DefaultGenreSnapshotParams(),
+		snapshot_src:         snapshot_src,
+		snapshot_rng:         rand.New(snapshot_src),
+		diversity_grid:       10,
+		retain_summery:       true,
+		checkpoint_file:      "",
+		checkpoint_every:     0,
+		started:              false,
+		verbose:              true,
 	}
 
 	// エージェントを作成
 	for i := range n_agents {
-		sim.agents[i] = MakeRandomAgentFromParams(GetNewID(), default_agent_params)
+		sim.agents[i] = MakeRandomAgentFromParams(GetNewID(), default_agent_params, sim.rng)
 	}
 
 	// サマリーを作成
@@ -30,38 +96,176 @@ func MakeNewSimulation(n_agents, n_iter int, ga_params *GAParams, default_agent_
 	return sim
 }
 
+// エージェントの実行順序を設定する
+func (s *Simulation) SetScheduler(scheduler Scheduler) {
+	s.scheduler = scheduler
+}
+
+// 並列実行を有効にする。workers は goroutine の数。
+// 並列に実行されるのは SynchronousScheduler の各段階だけで、他の実行順序では 1 人ずつ実行する。
+func (s *Simulation) SetParallel(workers int) {
+	s.parallel = true
+	s.workers = max(1, workers)
+}
+
+// 途中経過の通知先を登録する
+func (s *Simulation) AddObserver(observer SimulationObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// ジャンルのスナップショットの取り方を設定する
+func (s *Simulation) SetGenreSnapshot(params *GenreSnapshotParams) {
+	s.genre_snapshot = params
+}
+
+// 多様性の指標のセルの細かさ (ジャンル空間の各軸を grid 等分する) を設定する
+func (s *Simulation) SetDiversityGrid(grid int) {
+	s.diversity_grid = max(1, grid)
+}
+
+// false なら、最新のサマリー以外を保持しない
+// その場合 GetSummery は最新のサマリーだけを返すので、結果は SimulationObserver で受け取る
+func (s *Simulation) SetRetainSummery(retain bool) {
+	s.retain_summery = retain
+}
+
+// every イテレーションごとに file_name にチェックポイントを保存する (0 なら保存しない)
+func (s *Simulation) SetCheckpoint(file_name string, every int) {
+	s.checkpoint_file = file_name
+	s.checkpoint_every = every
+}
+
+// false なら、イテレーションごとの進み具合を表示しない
+func (s *Simulation) SetVerbose(verbose bool) {
+	s.verbose = verbose
+}
+
+// 終了したイテレーションの数
+func (s *Simulation) Iteration() int {
+	return s.iteration
+}
+
+// 実行するイテレーションの数
+func (s *Simulation) NumIterations() int {
+	return s.n_iter
+}
+
+// 実行するイテレーションの数を変える (終了したイテレーションより前にはできない)
+func (s *Simulation) SetNumIterations(n_iter int) error {
+	if n_iter < s.iteration {
+		return &ConfigError{"num_iterations", "must be at least the current iteration " + strconv.Itoa(s.iteration)}
+	}
+	summery := make([]*Summery, n_iter+1)
+	copy(summery, s.summery)
+	s.summery = summery
+	s.n_iter = n_iter
+	return nil
+}
+
 // シミュレーションを実行
-func (s *Simulation) Run() {
-	for i := range s.n_iter {
-		// 情報
-		println("Iteration:", i, "  Agents:", len(s.agents), "  Songs:", s.summery[i].num_song_now)
+// チェックポイントから再開した場合は、その続きから n_iter まで実行する
+func (s *Simulation) Run() error {
+	_, err := s.Advance(s.n_iter - s.iteration)
+	return err
+}
+
+// n イテレーション進める (n_iter を超えては進めない)。進めたイテレーションの数を返す。
+func (s *Simulation) Advance(n int) (int, error) {
+	// 初期状態 (イテレーション 0) のサマリーも通知する
+	if s.iteration == 0 && !s.started && len(s.observers) > 0 {
+		public := s.summery[0].Publish()
+		for _, observer := range s.observers {
+			observer.OnIterationEnd(public)
+		}
+	}
+	s.started = true
+
+	done := 0
+	for done < n && s.iteration < s.n_iter {
+		s.step()
+		done++
 
-		// new_agents にエージェントをコピー
-		// その際、エネルギーが 0 以下のエージェントを削除
-		new_agents := make([]*Agent, 0)
-		for _, agent := range s.agents {
-			if agent.energy > 0 {
-				new_agents = append(new_agents, agent)
+		if s.checkpoint_every > 0 && s.iteration%s.checkpoint_every == 0 {
+			if err := s.SaveCheckpointFile(s.checkpoint_file); err != nil {
+				return done, err
 			}
 		}
+	}
+	return done, nil
+}
+
+// 1 イテレーションを実行する
+func (s *Simulation) step() {
+	i := s.iteration
 
-		// サマリーを作成
-		s.summery[i+1] = MakeNewSummeryFromSummery(s.summery[i])
+	// 情報
+	if s.verbose {
+		println("Iteration:", i, "  Agents:", len(s.agents), "  Songs:", s.summery[i].num_song_now)
+	}
 
-		// 新しく生まれたエージェントを入れるプール
-		new_born_pool := make([]*Agent, 0)
+	// サマリーのイテレーション番号に合わせて通知する
+	for _, observer := range s.observers {
+		observer.OnIterationStart(i + 1)
+	}
 
-		// エージェントを実行
-		for _, agent := range new_agents {
-			agent.Run(&new_agents, &new_born_pool,
-				s.ga_params, s.default_agent_params, s.summery[i+1])
+	// new_agents にエージェントをコピー
+	// その際、前のイテレーションで死んだ (エネルギーが 0 以下の) エージェントを削除
+	new_agents := make([]*Agent, 0)
+	for _, agent := range s.agents {
+		if agent.energy > 0 {
+			agent.income = IncomeBreakdown{}
+			new_agents = append(new_agents, agent)
+		}
+	}
+
+	// サマリーを作成
+	s.summery[i+1] = MakeNewSummeryFromSummery(s.summery[i])
+
+	// 新しく生まれたエージェントを入れるプール
+	new_born_pool := make([]*Agent, 0)
+
+	// エージェントを実行
+	s.scheduler.Schedule(s, &new_agents, &new_born_pool, s.summery[i+1])
+
+	// エージェントを保存
+	s.agents = append(new_agents, new_born_pool...)
+
+	// このイテレーションで死んだエージェントの楽曲は失われる
+	// 削除は次のイテレーションの最初に行うが、サマリーと同じく、このイテレーションの終わりにはもう残っていないものとする
+	for _, agent := range s.agents {
+		if agent.energy <= 0 {
+			for _, song := range agent.creator.memory.Songs() {
+				song.extinct_iteration = i + 1
+			}
+
+			for _, observer := range s.observers {
+				observer.OnAgentDied(agent)
+			}
 		}
+	}
+
+	// サマリーを更新
+	s.summery[i+1].Calculate(s.agents)
+	s.summery[i+1].CalculateDiversity(s.agents, s.diversity_grid)
+	s.summery[i+1].CalculateInequality(s.agents)
+	s.summery[i+1].CalculateGeneDistribution(s.agents)
+	s.summery[i+1].CalculateIncome(s.agents)
+	s.summery[i+1].CalculateEventStats()
+	s.summery[i+1].TakeGenreSnapshot(s.agents, s.genre_snapshot, s.snapshot_rng)
+	if !s.retain_summery {
+		s.summery[i] = nil
+	}
 
-		// エージェントを保存
-		s.agents = append(new_agents, new_born_pool...)
+	// 新しく作成された楽曲を記録
+	s.songs = append(s.songs, s.summery[i+1].new_songs...)
 
-		// サマリーを更新
-		s.summery[i+1].Calculate(s.agents)
+	s.iteration = i + 1
+
+	if len(s.observers) > 0 {
+		public := s.summery[i+1].Publish()
+		for _, observer := range s.observers {
+			observer.OnIterationEnd(public)
+		}
 	}
 }
 
@@ -69,3 +273,50 @@ func (s *Simulation) Run() {
 func (s *Simulation) GetSummery() []*PublicSummery {
 	return PublishAllSummery(s.summery)
 }
+
+// 楽曲の系統樹を返す
+func (s *Simulation) GetPhylogeny() []*PhylogenyNode {
+	return BuildPhylogeny(s.songs)
+}
+
+// 楽曲カタログを返す
+func (s *Simulation) GetSongCatalog() []*CatalogEntry {
+	return BuildSongCatalog(s.songs)
+}
+
+// 1 段階分を全エージェントが同時に行ったものとして実行し、副作用と集計をエージェントの順に適用する
+// 並列実行なら workers 個の goroutine に分けるが、逐次実行でも同じように副作用を記録してから適用する。
+func (s *Simulation) runPhase(phase int, agents, new_born_pool *[]*Agent, summery *Summery) {
+	n := len(*agents)
+	effects := make([]*Effects, n)
+	summeries := make([]*Summery, n)
+
+	run := func(start, end int) {
+		for j := start; j < end; j++ {
+			effects[j] = MakeBufferedEffects(new_born_pool, s.observers)
+			summeries[j] = summery.MakeScratch()
+			(*agents)[j].RunPhase(phase, agents, s.ga_params, s.default_agent_params, summeries[j], effects[j])
+		}
+	}
+
+	if !s.parallel || s.workers == 1 {
+		run(0, n)
+	} else {
+		// エージェントを workers 個に分けて実行
+		var wg sync.WaitGroup
+		chunk := (n + s.workers - 1) / s.workers
+		for start := 0; start < n; start += chunk {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				run(start, min(start+chunk, n))
+			}()
+		}
+		wg.Wait()
+	}
+
+	for j := range n {
+		effects[j].Apply()
+		summery.Merge(summeries[j])
+	}
+}
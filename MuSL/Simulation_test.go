@@ -0,0 +1,61 @@
+package MuSL
+
+import (
+	"testing"
+)
+
+// 系統樹で各イテレーションの終わりに残っている曲の数は、サマリーの num_song_now と一致する
+func TestPhylogenyMatchesSongCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		seed   int64
+	}{
+		{"unlimited memory", ForgetNone, 7},
+		{"unlimited memory", ForgetNone, 20},
+		{"fifo memory", ForgetFIFO, 7},
+		{"decay memory", ForgetDecay, 11},
+	}
+
+	for _, test := range tests {
+		c := test_config(ScheduleFixed, test.seed)
+		c.NumIterations = 40
+		c.MemoryPolicy = test.policy
+		if test.policy != ForgetNone {
+			c.MemoryCapacity = 5
+		}
+
+		sim, err := c.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		nodes := flatten_phylogeny(sim.GetPhylogeny())
+		for _, summery := range sim.GetSummery() {
+			alive := 0
+			for _, node := range nodes {
+				if node.Iteration <= summery.Iteration && (node.ExtinctIteration < 0 || node.ExtinctIteration > summery.Iteration) {
+					alive++
+				}
+			}
+			if alive != summery.NumSongNow {
+				t.Errorf("%s, seed %d, iteration %d: %d songs alive in the phylogeny, num_song_now %d",
+					test.name, test.seed, summery.Iteration, alive, summery.NumSongNow)
+			}
+		}
+	}
+}
+
+// 系統樹のすべてのノードを返す
+func flatten_phylogeny(roots []*PhylogenyNode) []*PhylogenyNode {
+	nodes := make([]*PhylogenyNode, 0)
+	for _, root := range roots {
+		nodes = append(nodes, root)
+		nodes = append(nodes, flatten_phylogeny(root.Children)...)
+	}
+	return nodes
+}
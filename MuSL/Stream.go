@@ -0,0 +1,87 @@
+package MuSL
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// イテレーションごとのサマリーを 1 行 1 JSON (NDJSON) で書き出す SimulationObserver
+// Calculate が終わるたびに書き出し、flush_every イテレーションごとに flush するので、
+// 途中で止まってもそれまでの結果が残り、tail -f などで途中経過を読むことができる。
+type StreamWriter struct {
+	NopObserver
+	writer      *bufio.Writer
+	encoder     *json.Encoder
+	flush_every int
+	count       int
+	err         error
+}
+
+func MakeStreamWriter(w io.Writer, flush_every int) *StreamWriter {
+	writer := bufio.NewWriter(w)
+	return &StreamWriter{
+		writer:      writer,
+		encoder:     json.NewEncoder(writer),
+		flush_every: max(1, flush_every),
+		count:       0,
+		err:         nil,
+	}
+}
+
+func (sw *StreamWriter) OnIterationEnd(summery *PublicSummery) {
+	// 一度失敗したら書き込まない
+	if sw.err != nil {
+		return
+	}
+
+	// Encode は末尾に改行を付ける
+	if sw.err = sw.encoder.Encode(summery); sw.err != nil {
+		return
+	}
+
+	sw.count++
+	if sw.count%sw.flush_every == 0 {
+		sw.err = sw.writer.Flush()
+	}
+}
+
+// バッファに残っている分を書き出す。それまでに起きたエラーがあれば返す。
+func (sw *StreamWriter) Flush() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.err = sw.writer.Flush()
+	return sw.err
+}
+
+// サマリーを読み込む
+// output_file の JSON の配列と、StreamWriter の NDJSON のどちらにも対応する。
+func ReadSummeries(r io.Reader) ([]*PublicSummery, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON の配列
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		summeries := make([]*PublicSummery, 0)
+		err := json.Unmarshal(trimmed, &summeries)
+		return summeries, err
+	}
+
+	// NDJSON
+	summeries := make([]*PublicSummery, 0)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		summery := &PublicSummery{}
+		if err := decoder.Decode(summery); err == io.EOF {
+			break
+		} else if err != nil {
+			return summeries, err
+		}
+		summeries = append(summeries, summery)
+	}
+	return summeries, nil
+}
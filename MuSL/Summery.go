@@ -3,130 +3,421 @@ package MuSL
 // シミュレーションのサマリー
 type Summery struct {
 	// [*] は、イテレーションの最後に Calculate で計算するもの
-	num_population         int     // [*] 人数 (B)
-	num_creaters           int     // [*] 作成者の人数 (B)
-	num_listeners          int     // [*] 聴取者の人数 (B)
-	num_organizers         int     // [*] 運営者の人数 (B)
-	num_song_all           int     //     いままで作成された楽曲の総数 (E)
-	num_song_this          int     //     そのイテレーションで作成された楽曲の総数 (E)
-	num_song_now           int     // [*] 現在残っているエージェントの楽曲の総数 (E)
-	num_evaluation_all     int     //     いままで行われた評価の総数 (E)
-	num_evaluation_this    int     //     そのイテレーションで行われた評価の総数 (E)
-	num_event_all          int     //     いままで開催されたイベントの総数 (E)
-	num_event_this         int     //     そのイテレーションで開催されたイベントの総数 (E)
-	avg_innovation         float64 // [*] 作成者の新規性の平均 (C)
-	avg_novelty_preference float64 // [*] 聴取者の新規性好みの平均 (C)
-	sum_evaluation         float64 //     そのイテレーションで行われた評価の合計 (G)
-	avg_evaluation         float64 // [*] そのイテレーションで行われた評価の平均 (G)
-	total_energy           float64 // [*] エネルギーの総量 (D)
-	energy_creators        float64 // [*] 作成者のエネルギーの総量 (F)
-	energy_listeners       float64 // [*] 聴取者のエネルギーの総量 (F)
-	energy_organizers      float64 // [*] 運営者のエネルギーの総量 (F)
-	all_genres             [][]float64
+	iteration               int                         //     イテレーション番号 (初期状態は 0)
+	num_population          int                         // [*] 人数 (B)
+	num_creaters            int                         // [*] 作成者の人数 (B)
+	num_listeners           int                         // [*] 聴取者の人数 (B)
+	num_organizers          int                         // [*] 運営者の人数 (B)
+	role_census             map[string]RoleCount        // [*] 役割の組み合わせごとの人数とエネルギー (B)
+	role_transitions        map[role_transition_key]int // 親から子への役割の組み合わせの遷移の数 (B)
+	num_song_all            int                         //     いままで作成された楽曲の総数 (E)
+	num_song_this           int                         //     そのイテレーションで作成された楽曲の総数 (E)
+	num_song_now            int                         // [*] 現在残っているエージェントの楽曲の総数 (E)
+	num_evaluation_all      int                         //     いままで行われた評価の総数 (E)
+	num_evaluation_this     int                         //     そのイテレーションで行われた評価の総数 (E)
+	num_event_all           int                         //     いままで開催されたイベントの総数 (E)
+	num_event_this          int                         //     そのイテレーションで開催されたイベントの総数 (E)
+	num_major_event_this    int                         //     そのイテレーションで開催されたメジャーイベントの数 (E)
+	num_minor_event_this    int                         //     そのイテレーションで開催されたマイナーイベントの数 (E)
+	num_recommendation_this int                         //     そのイテレーションでリスナーに届いたおすすめの数 (E)
+	event_num_songs         []int                       //     そのイテレーションで開催されたイベントごとの曲数 (E、公開しない)
+	event_num_listeners     []int                       //     そのイテレーションで開催されたイベントごとのリスナー数 (E、公開しない)
+	songs_per_event         *CountStats                 // [*] イベントあたりの曲数の分布 (E)
+	listeners_per_event     *CountStats                 // [*] イベントあたりのリスナー数の分布 (E)
+	avg_songs_per_event     float64                     // [*] イベントあたりの曲数の平均 (E)
+	avg_listeners_per_event float64                     // [*] イベントあたりのリスナー数の平均 (E)
+	num_settled_songs       int                         //     そのイテレーションで精算されたイベントの曲数の合計 (E)
+	num_evaluated_songs     int                         //     そのうち 1 回以上評価された曲の数 (E)
+	evaluation_coverage     float64                     // [*] num_evaluated_songs / num_settled_songs (E)
+	winner_payout           float64                     //     精算されたメジャーイベントで上位の曲に支払われた報酬 (E、公開しない)
+	major_payout            float64                     //     精算されたメジャーイベントで支払われた報酬の合計 (E、公開しない)
+	winner_payout_share     float64                     // [*] winner_payout / major_payout (E)
+	avg_innovation          float64                     // [*] 作成者の新規性の平均 (C)
+	avg_novelty_preference  float64                     // [*] 聴取者の新規性好みの平均 (C)
+	sum_evaluation          float64                     //     そのイテレーションで行われた評価の合計 (G)
+	avg_evaluation          float64                     // [*] そのイテレーションで行われた評価の平均 (G)
+	total_energy            float64                     // [*] エネルギーの総量 (D)
+	energy_creators         float64                     // [*] 作成者のエネルギーの総量 (F)
+	energy_listeners        float64                     // [*] 聴取者のエネルギーの総量 (F)
+	energy_organizers       float64                     // [*] 運営者のエネルギーの総量 (F)
+	income_decomposition    *IncomeDecomposition        // [*] 役割ごとのエネルギーの増減の内訳 (F)
+	genre_entropy           float64                     // [*] 生きている曲のジャンルのセルごとのエントロピー (A)
+	genre_richness          int                         // [*] 生きている曲があるセルの数 (A)
+	genre_mean_distance     float64                     // [*] 生きている曲のジャンルの平均距離 (A)
+	genre_hull_area         float64                     // [*] 生きている曲のジャンルの凸包の面積 (A、ジャンルが 2 次元の場合のみ)
+	new_genre_entropy       float64                     // [*] そのイテレーションで作成された曲のエントロピー (A)
+	new_genre_richness      int                         // [*] そのイテレーションで作成された曲があるセルの数 (A)
+	new_genre_mean_distance float64                     // [*] そのイテレーションで作成された曲の平均距離 (A)
+	new_genre_hull_area     float64                     // [*] そのイテレーションで作成された曲の凸包の面積 (A、ジャンルが 2 次元の場合のみ)
+	energy_gini             float64                     // [*] 生きているエージェントのエネルギーのジニ係数 (H)
+	energy_top10_share      float64                     // [*] エネルギーの上位 10% が占める割合 (H)
+	energy_theil            float64                     // [*] エネルギーのタイル指数 (H)
+	income_gini             float64                     // [*] 作成者がそのイテレーションにイベントから得た報酬のジニ係数 (H)
+	income_top10_share      float64                     // [*] 作成者の報酬の上位 10% が占める割合 (H)
+	income_theil            float64                     // [*] 作成者の報酬のタイル指数 (H)
+	gene_distribution       *GeneDistribution           // [*] 生きているエージェントと役割ごとの遺伝子の分布 (C)
+	all_genres              [][]float64                 //     ジャンルのスナップショット (A)
+	genres_compact          string                      //     圧縮したジャンルのスナップショット (A)
+	new_songs               []*Song                     // そのイテレーションで作成された楽曲 (系統樹用、公開しない)
 }
 
 type PublicSummery struct {
-	NumPopulation        int     `json:"num_population"`
-	NumCreaters          int     `json:"num_creaters"`
-	NumListeners         int     `json:"num_listeners"`
-	NumOrganizers        int     `json:"num_organizers"`
-	NumSongAll           int     `json:"num_song_all"`
-	NumSongThis          int     `json:"num_song_this"`
-	NumSongNow           int     `json:"num_song_now"`
-	NumEvaluationAll     int     `json:"num_evaluation_all"`
-	NumEvaluationThis    int     `json:"num_evaluation_this"`
-	NumEventAll          int     `json:"num_event_all"`
-	NumEventThis         int     `json:"num_event_this"`
-	AvgInnovation        float64 `json:"avg_innovation"`
-	AvgNoveltyPreference float64 `json:"avg_novelty_preference"`
-	SumEvaluation        float64 `json:"sum_evaluation"`
-	AvgEvaluation        float64 `json:"avg_evaluation"`
-	TotalEnergy          float64 `json:"total_energy"`
-	EnergyCreators       float64 `json:"energy_creators"`
-	EnergyListeners      float64 `json:"energy_listeners"`
-	EnergyOrganizers     float64 `json:"energy_organizers"`
-	AllGenres            [][]float64
+	Iteration             int                  `json:"iteration"`
+	NumPopulation         int                  `json:"num_population"`
+	NumCreaters           int                  `json:"num_creaters"`
+	NumListeners          int                  `json:"num_listeners"`
+	NumOrganizers         int                  `json:"num_organizers"`
+	RoleCensus            map[string]RoleCount `json:"role_census"`
+	RoleTransitions       []RoleTransition     `json:"role_transitions"`
+	NumSongAll            int                  `json:"num_song_all"`
+	NumSongThis           int                  `json:"num_song_this"`
+	NumSongNow            int                  `json:"num_song_now"`
+	NumEvaluationAll      int                  `json:"num_evaluation_all"`
+	NumEvaluationThis     int                  `json:"num_evaluation_this"`
+	NumEventAll           int                  `json:"num_event_all"`
+	NumEventThis          int                  `json:"num_event_this"`
+	NumMajorEventThis     int                  `json:"num_major_event_this"`
+	NumMinorEventThis     int                  `json:"num_minor_event_this"`
+	NumRecommendationThis int                  `json:"num_recommendation_this"`
+	SongsPerEvent         *CountStats          `json:"songs_per_event,omitempty"`
+	ListenersPerEvent     *CountStats          `json:"listeners_per_event,omitempty"`
+	AvgSongsPerEvent      float64              `json:"avg_songs_per_event"`
+	AvgListenersPerEvent  float64              `json:"avg_listeners_per_event"`
+	NumSettledSongs       int                  `json:"num_settled_songs"`
+	NumEvaluatedSongs     int                  `json:"num_evaluated_songs"`
+	EvaluationCoverage    float64              `json:"evaluation_coverage"`
+	WinnerPayoutShare     float64              `json:"winner_payout_share"`
+	AvgInnovation         float64              `json:"avg_innovation"`
+	AvgNoveltyPreference  float64              `json:"avg_novelty_preference"`
+	SumEvaluation         float64              `json:"sum_evaluation"`
+	AvgEvaluation         float64              `json:"avg_evaluation"`
+	TotalEnergy           float64              `json:"total_energy"`
+	EnergyCreators        float64              `json:"energy_creators"`
+	EnergyListeners       float64              `json:"energy_listeners"`
+	EnergyOrganizers      float64              `json:"energy_organizers"`
+	IncomeDecomposition   *IncomeDecomposition `json:"income_decomposition,omitempty"`
+	GainedAll             float64              `json:"income_gained_all"`
+	SpentAll              float64              `json:"income_spent_all"`
+	GainedCreators        float64              `json:"income_gained_creators"`
+	SpentCreators         float64              `json:"income_spent_creators"`
+	GainedListeners       float64              `json:"income_gained_listeners"`
+	SpentListeners        float64              `json:"income_spent_listeners"`
+	GainedOrganizers      float64              `json:"income_gained_organizers"`
+	SpentOrganizers       float64              `json:"income_spent_organizers"`
+	GenreEntropy          float64              `json:"genre_entropy"`
+	GenreRichness         int                  `json:"genre_richness"`
+	GenreMeanDistance     float64              `json:"genre_mean_distance"`
+	GenreHullArea         float64              `json:"genre_hull_area"` // ジャンルが 2 次元の場合のみ計算する (シミュレーションのジャンルは常に 2 次元)
+	NewGenreEntropy       float64              `json:"new_genre_entropy"`
+	NewGenreRichness      int                  `json:"new_genre_richness"`
+	NewGenreMeanDistance  float64              `json:"new_genre_mean_distance"`
+	NewGenreHullArea      float64              `json:"new_genre_hull_area"` // GenreHullArea と同じく 2 次元の場合のみ
+	EnergyGini            float64              `json:"energy_gini"`
+	EnergyTop10Share      float64              `json:"energy_top10_share"`
+	EnergyTheil           float64              `json:"energy_theil"`
+	IncomeGini            float64              `json:"income_gini"`
+	IncomeTop10Share      float64              `json:"income_top10_share"`
+	IncomeTheil           float64              `json:"income_theil"`
+	GeneDistribution      *GeneDistribution    `json:"gene_distribution,omitempty"`
+	AllGenres             [][]float64
+	GenresCompact         string `json:"genres_compact,omitempty"`
 }
 
 func MakeNewSummery() *Summery {
 	return &Summery{
-		num_population:         0,
-		num_creaters:           0,
-		num_listeners:          0,
-		num_organizers:         0,
-		num_song_all:           0,
-		num_song_this:          0,
-		num_song_now:           0,
-		num_evaluation_all:     0,
-		num_evaluation_this:    0,
-		num_event_all:          0,
-		num_event_this:         0,
-		avg_innovation:         0,
-		avg_novelty_preference: 0,
-		sum_evaluation:         0,
-		avg_evaluation:         0,
-		total_energy:           0,
-		energy_creators:        0,
-		energy_listeners:       0,
-		energy_organizers:      0,
-		all_genres:             [][]float64{},
+		iteration:               0,
+		num_population:          0,
+		num_creaters:            0,
+		num_listeners:           0,
+		num_organizers:          0,
+		role_census:             make_role_census(),
+		role_transitions:        make(map[role_transition_key]int),
+		num_song_all:            0,
+		num_song_this:           0,
+		num_song_now:            0,
+		num_evaluation_all:      0,
+		num_evaluation_this:     0,
+		num_event_all:           0,
+		num_event_this:          0,
+		num_major_event_this:    0,
+		num_minor_event_this:    0,
+		num_recommendation_this: 0,
+		event_num_songs:         []int{},
+		event_num_listeners:     []int{},
+		songs_per_event:         nil,
+		listeners_per_event:     nil,
+		avg_songs_per_event:     0,
+		avg_listeners_per_event: 0,
+		num_settled_songs:       0,
+		num_evaluated_songs:     0,
+		evaluation_coverage:     0,
+		winner_payout:           0,
+		major_payout:            0,
+		winner_payout_share:     0,
+		avg_innovation:          0,
+		avg_novelty_preference:  0,
+		sum_evaluation:          0,
+		avg_evaluation:          0,
+		total_energy:            0,
+		energy_creators:         0,
+		energy_listeners:        0,
+		energy_organizers:       0,
+		income_decomposition:    nil,
+		genre_entropy:           0,
+		genre_richness:          0,
+		genre_mean_distance:     0,
+		genre_hull_area:         0,
+		new_genre_entropy:       0,
+		new_genre_richness:      0,
+		new_genre_mean_distance: 0,
+		new_genre_hull_area:     0,
+		energy_gini:             0,
+		energy_top10_share:      0,
+		energy_theil:            0,
+		income_gini:             0,
+		income_top10_share:      0,
+		income_theil:            0,
+		gene_distribution:       nil,
+		all_genres:              [][]float64{},
+		genres_compact:          "",
+		new_songs:               []*Song{},
 	}
 }
 
 func MakeNewSummeryFromSummery(s *Summery) *Summery {
 	return &Summery{
-		num_population:         0,                    // 1-1 再計算
-		num_creaters:           0,                    // 1-2 再計算
-		num_listeners:          0,                    // 1-3 再計算
-		num_organizers:         0,                    // 1-4 再計算
-		num_song_all:           s.num_song_all,       // 加算 (I)
-		num_song_this:          0,                    // リセットして集計 (I)
-		num_song_now:           0,                    // 2 再計算
-		num_evaluation_all:     s.num_evaluation_all, // 加算 (II)
-		num_evaluation_this:    0,                    // リセットして集計 (II)
-		num_event_all:          s.num_event_all,      // 加算 (III)
-		num_event_this:         0,                    // リセットして集計 (III)
-		avg_innovation:         0,                    // 3-1 再計算
-		avg_novelty_preference: 0,                    // 3-2 再計算
-		sum_evaluation:         0,                    // リセットして集計 (IV)
-		avg_evaluation:         0,                    // 4 再計算
-		total_energy:           0,                    // 5-1 再計算
-		energy_creators:        0,                    // 5-2 再計算
-		energy_listeners:       0,                    // 5-3 再計算
-		energy_organizers:      0,                    // 5-4 再計算
-		all_genres:             [][]float64{},        // 6 再取得
+		iteration:               s.iteration + 1,                   // 次のイテレーション
+		num_population:          0,                                 // 1-1 再計算
+		num_creaters:            0,                                 // 1-2 再計算
+		num_listeners:           0,                                 // 1-3 再計算
+		num_organizers:          0,                                 // 1-4 再計算
+		role_census:             make_role_census(),                // 1-5 再計算
+		role_transitions:        make(map[role_transition_key]int), // リセットして集計 (V)
+		num_song_all:            s.num_song_all,                    // 加算 (I)
+		num_song_this:           0,                                 // リセットして集計 (I)
+		num_song_now:            0,                                 // 2 再計算
+		num_evaluation_all:      s.num_evaluation_all,              // 加算 (II)
+		num_evaluation_this:     0,                                 // リセットして集計 (II)
+		num_event_all:           s.num_event_all,                   // 加算 (III)
+		num_event_this:          0,                                 // リセットして集計 (III)
+		num_major_event_this:    0,                                 // リセットして集計 (III)
+		num_minor_event_this:    0,                                 // リセットして集計 (III)
+		num_recommendation_this: 0,                                 // リセットして集計 (III)
+		event_num_songs:         []int{},                           // リセットして集計 (III)
+		event_num_listeners:     []int{},                           // リセットして集計 (III)
+		songs_per_event:         nil,                               // 11-1 再計算
+		listeners_per_event:     nil,                               // 11-2 再計算
+		avg_songs_per_event:     0,                                 // 11-3 再計算
+		avg_listeners_per_event: 0,                                 // 11-4 再計算
+		num_settled_songs:       0,                                 // リセットして集計 (III)
+		num_evaluated_songs:     0,                                 // リセットして集計 (III)
+		evaluation_coverage:     0,                                 // 11-5 再計算
+		winner_payout:           0,                                 // リセットして集計 (III)
+		major_payout:            0,                                 // リセットして集計 (III)
+		winner_payout_share:     0,                                 // 11-6 再計算
+		avg_innovation:          0,                                 // 3-1 再計算
+		avg_novelty_preference:  0,                                 // 3-2 再計算
+		sum_evaluation:          0,                                 // リセットして集計 (IV)
+		avg_evaluation:          0,                                 // 4 再計算
+		total_energy:            0,                                 // 5-1 再計算
+		energy_creators:         0,                                 // 5-2 再計算
+		energy_listeners:        0,                                 // 5-3 再計算
+		energy_organizers:       0,                                 // 5-4 再計算
+		income_decomposition:    nil,                               // 10 再計算
+		genre_entropy:           0,                                 // 7-1 再計算
+		genre_richness:          0,                                 // 7-2 再計算
+		genre_mean_distance:     0,                                 // 7-3 再計算
+		genre_hull_area:         0,                                 // 7-4 再計算
+		new_genre_entropy:       0,                                 // 7-5 再計算
+		new_genre_richness:      0,                                 // 7-6 再計算
+		new_genre_mean_distance: 0,                                 // 7-7 再計算
+		new_genre_hull_area:     0,                                 // 7-8 再計算
+		energy_gini:             0,                                 // 8-1 再計算
+		energy_top10_share:      0,                                 // 8-2 再計算
+		energy_theil:            0,                                 // 8-3 再計算
+		income_gini:             0,                                 // 8-4 再計算
+		income_top10_share:      0,                                 // 8-5 再計算
+		income_theil:            0,                                 // 8-6 再計算
+		gene_distribution:       nil,                               // 9 再計算
+		all_genres:              [][]float64{},                     // 6 再取得
+		genres_compact:          "",                                // 6 再取得
+		new_songs:               []*Song{},                         // リセットして集計 (I)
+	}
+}
+
+// 並列実行で、エージェントごとに集計 (I)〜(V) を行うための空のサマリーを作成する
+func (s *Summery) MakeScratch() *Summery {
+	scratch := MakeNewSummery()
+	scratch.iteration = s.iteration
+	return scratch
+}
+
+// MakeScratch で作成したサマリーの集計 (I)〜(V) を加算する
+func (s *Summery) Merge(scratch *Summery) {
+	s.num_song_all += scratch.num_song_all                                                // (I)
+	s.num_song_this += scratch.num_song_this                                              // (I)
+	s.new_songs = append(s.new_songs, scratch.new_songs...)                               // (I)
+	s.num_evaluation_all += scratch.num_evaluation_all                                    // (II)
+	s.num_evaluation_this += scratch.num_evaluation_this                                  // (II)
+	s.num_event_all += scratch.num_event_all                                              // (III)
+	s.num_event_this += scratch.num_event_this                                            // (III)
+	s.num_major_event_this += scratch.num_major_event_this                                // (III)
+	s.num_minor_event_this += scratch.num_minor_event_this                                // (III)
+	s.num_recommendation_this += scratch.num_recommendation_this                          // (III)
+	s.event_num_songs = append(s.event_num_songs, scratch.event_num_songs...)             // (III)
+	s.event_num_listeners = append(s.event_num_listeners, scratch.event_num_listeners...) // (III)
+	s.num_settled_songs += scratch.num_settled_songs                                      // (III)
+	s.num_evaluated_songs += scratch.num_evaluated_songs                                  // (III)
+	s.winner_payout += scratch.winner_payout                                              // (III)
+	s.major_payout += scratch.major_payout                                                // (III)
+	s.sum_evaluation += scratch.sum_evaluation                                            // (IV)
+	for key, count := range scratch.role_transitions {
+		s.role_transitions[key] += count // (V)
 	}
 }
 
 func (s *Summery) Publish() *PublicSummery {
-	return &PublicSummery{
-		NumPopulation:        s.num_population,
-		NumCreaters:          s.num_creaters,
-		NumListeners:         s.num_listeners,
-		NumOrganizers:        s.num_organizers,
-		NumSongAll:           s.num_song_all,
-		NumSongThis:          s.num_song_this,
-		NumSongNow:           s.num_song_now,
-		NumEvaluationAll:     s.num_evaluation_all,
-		NumEvaluationThis:    s.num_evaluation_this,
-		NumEventAll:          s.num_event_all,
-		NumEventThis:         s.num_event_this,
-		AvgInnovation:        s.avg_innovation,
-		AvgNoveltyPreference: s.avg_novelty_preference,
-		SumEvaluation:        s.sum_evaluation,
-		AvgEvaluation:        s.avg_evaluation,
-		TotalEnergy:          s.total_energy,
-		EnergyCreators:       s.energy_creators,
-		EnergyListeners:      s.energy_listeners,
-		EnergyOrganizers:     s.energy_organizers,
-		AllGenres:            s.all_genres,
+	public := &PublicSummery{
+		Iteration:             s.iteration,
+		NumPopulation:         s.num_population,
+		NumCreaters:           s.num_creaters,
+		NumListeners:          s.num_listeners,
+		NumOrganizers:         s.num_organizers,
+		RoleCensus:            s.role_census,
+		RoleTransitions:       publish_role_transitions(s.role_transitions),
+		NumSongAll:            s.num_song_all,
+		NumSongThis:           s.num_song_this,
+		NumSongNow:            s.num_song_now,
+		NumEvaluationAll:      s.num_evaluation_all,
+		NumEvaluationThis:     s.num_evaluation_this,
+		NumEventAll:           s.num_event_all,
+		NumEventThis:          s.num_event_this,
+		NumMajorEventThis:     s.num_major_event_this,
+		NumMinorEventThis:     s.num_minor_event_this,
+		NumRecommendationThis: s.num_recommendation_this,
+		SongsPerEvent:         s.songs_per_event,
+		ListenersPerEvent:     s.listeners_per_event,
+		AvgSongsPerEvent:      s.avg_songs_per_event,
+		AvgListenersPerEvent:  s.avg_listeners_per_event,
+		NumSettledSongs:       s.num_settled_songs,
+		NumEvaluatedSongs:     s.num_evaluated_songs,
+		EvaluationCoverage:    s.evaluation_coverage,
+		WinnerPayoutShare:     s.winner_payout_share,
+		AvgInnovation:         s.avg_innovation,
+		AvgNoveltyPreference:  s.avg_novelty_preference,
+		SumEvaluation:         s.sum_evaluation,
+		AvgEvaluation:         s.avg_evaluation,
+		TotalEnergy:           s.total_energy,
+		EnergyCreators:        s.energy_creators,
+		EnergyListeners:       s.energy_listeners,
+		EnergyOrganizers:      s.energy_organizers,
+		IncomeDecomposition:   s.income_decomposition,
+		GenreEntropy:          s.genre_entropy,
+		GenreRichness:         s.genre_richness,
+		GenreMeanDistance:     s.genre_mean_distance,
+		GenreHullArea:         s.genre_hull_area,
+		NewGenreEntropy:       s.new_genre_entropy,
+		NewGenreRichness:      s.new_genre_richness,
+		NewGenreMeanDistance:  s.new_genre_mean_distance,
+		NewGenreHullArea:      s.new_genre_hull_area,
+		EnergyGini:            s.energy_gini,
+		EnergyTop10Share:      s.energy_top10_share,
+		EnergyTheil:           s.energy_theil,
+		IncomeGini:            s.income_gini,
+		IncomeTop10Share:      s.income_top10_share,
+		IncomeTheil:           s.income_theil,
+		GeneDistribution:      s.gene_distribution,
+		AllGenres:             s.all_genres,
+		GenresCompact:         s.genres_compact,
+	}
+	// income_decomposition の合計は、CSV に出力できるようにスカラー値としても公開する
+	if d := s.income_decomposition; d != nil {
+		public.GainedAll, public.SpentAll = d.All.Gained, d.All.Spent
+		public.GainedCreators, public.SpentCreators = d.Creators.Gained, d.Creators.Spent
+		public.GainedListeners, public.SpentListeners = d.Listeners.Gained, d.Listeners.Spent
+		public.GainedOrganizers, public.SpentOrganizers = d.Organizers.Gained, d.Organizers.Spent
+	}
+	return public
+}
+
+// Publish の逆。チェックポイントからの再開に用いる。
+func MakeSummeryFromPublic(p *PublicSummery) *Summery {
+	all_genres := p.AllGenres
+	if all_genres == nil {
+		all_genres = [][]float64{}
+	}
+	role_census := p.RoleCensus
+	if role_census == nil {
+		role_census = make_role_census()
+	}
+
+	return &Summery{
+		iteration:               p.Iteration,
+		num_population:          p.NumPopulation,
+		num_creaters:            p.NumCreaters,
+		num_listeners:           p.NumListeners,
+		num_organizers:          p.NumOrganizers,
+		role_census:             role_census,
+		role_transitions:        load_role_transitions(p.RoleTransitions),
+		num_song_all:            p.NumSongAll,
+		num_song_this:           p.NumSongThis,
+		num_song_now:            p.NumSongNow,
+		num_evaluation_all:      p.NumEvaluationAll,
+		num_evaluation_this:     p.NumEvaluationThis,
+		num_event_all:           p.NumEventAll,
+		num_event_this:          p.NumEventThis,
+		num_major_event_this:    p.NumMajorEventThis,
+		num_minor_event_this:    p.NumMinorEventThis,
+		num_recommendation_this: p.NumRecommendationThis,
+		event_num_songs:         []int{},
+		event_num_listeners:     []int{},
+		songs_per_event:         p.SongsPerEvent,
+		listeners_per_event:     p.ListenersPerEvent,
+		avg_songs_per_event:     p.AvgSongsPerEvent,
+		avg_listeners_per_event: p.AvgListenersPerEvent,
+		num_settled_songs:       p.NumSettledSongs,
+		num_evaluated_songs:     p.NumEvaluatedSongs,
+		evaluation_coverage:     p.EvaluationCoverage,
+		winner_payout:           0,
+		major_payout:            0,
+		winner_payout_share:     p.WinnerPayoutShare,
+		avg_innovation:          p.AvgInnovation,
+		avg_novelty_preference:  p.AvgNoveltyPreference,
+		sum_evaluation:          p.SumEvaluation,
+		avg_evaluation:          p.AvgEvaluation,
+		total_energy:            p.TotalEnergy,
+		energy_creators:         p.EnergyCreators,
+		energy_listeners:        p.EnergyListeners,
+		energy_organizers:       p.EnergyOrganizers,
+		income_decomposition:    p.IncomeDecomposition,
+		genre_entropy:           p.GenreEntropy,
+		genre_richness:          p.GenreRichness,
+		genre_mean_distance:     p.GenreMeanDistance,
+		genre_hull_area:         p.GenreHullArea,
+		new_genre_entropy:       p.NewGenreEntropy,
+		new_genre_richness:      p.NewGenreRichness,
+		new_genre_mean_distance: p.NewGenreMeanDistance,
+		new_genre_hull_area:     p.NewGenreHullArea,
+		energy_gini:             p.EnergyGini,
+		energy_top10_share:      p.EnergyTop10Share,
+		energy_theil:            p.EnergyTheil,
+		income_gini:             p.IncomeGini,
+		income_top10_share:      p.IncomeTop10Share,
+		income_theil:            p.IncomeTheil,
+		gene_distribution:       p.GeneDistribution,
+		all_genres:              all_genres,
+		genres_compact:          p.GenresCompact,
+		new_songs:               []*Song{},
 	}
 }
 
+// 保持していない (nil の) サマリーは飛ばす
 func PublishAllSummery(summery []*Summery) []*PublicSummery {
-	ret := make([]*PublicSummery, len(summery))
-	for i, s := range summery {
-		ret[i] = s.Publish()
+	ret := make([]*PublicSummery, 0, len(summery))
+	for _, s := range summery {
+		if s != nil {
+			ret = append(ret, s.Publish())
+		}
 	}
 	return ret
 }
@@ -143,6 +434,13 @@ func (s *Summery) Calculate(agents []*Agent) {
 		s.num_population++             // 1-1
 		s.total_energy += agent.energy // 5-1
 
+		// 役割の組み合わせごとに集計 (1-5)
+		combination := RoleCombination(agent.role)
+		census := s.role_census[combination]
+		census.Count++
+		census.Energy += agent.energy
+		s.role_census[combination] = census
+
 		// エージェントの役割ごとに集計
 		if agent.role[0] {
 			s.num_creaters++                  // 1-2
@@ -164,10 +462,7 @@ func (s *Summery) Calculate(agents []*Agent) {
 		}
 
 		// 残っている楽曲の数
-		s.num_song_now += len(agent.creator.memory) // 2
-		for _, song := range agent.creator.memory {
-			s.all_genres = append(s.all_genres, song.genre) // 6
-		}
+		s.num_song_now += agent.creator.memory.Len() // 2
 	}
 
 	// 最後に平均を計算
@@ -0,0 +1,248 @@
+package MuSL
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// エージェントの状態の記録の形式
+const (
+	TraceCSV    = "csv"
+	TraceNDJSON = "ndjson"
+)
+
+// あるイテレーションの終わりの、生きているエージェント 1 人分の状態
+// SongsCreated, EvaluationsMade, EventsOrganized は前回記録したイテレーションからの回数
+type AgentTrace struct {
+	Iteration       int       `json:"iteration"`
+	ID              int       `json:"id"`
+	Role            []bool    `json:"role"`
+	Energy          float64   `json:"energy"`
+	Gene            []float64 `json:"gene"` // ToGene の順 (GeneNames)
+	CreatorMemory   int       `json:"creator_memory"`
+	ListenerMemory  int       `json:"listener_memory"`
+	SongsCreated    int       `json:"songs_created"`
+	EvaluationsMade int       `json:"evaluations_made"`
+	EventsOrganized int       `json:"events_organized"`
+}
+
+// every イテレーションごとに、生きているエージェントの状態を 1 人 1 行で書き出す SimulationObserver
+// 作曲、評価、イベント開催の回数は通知から数える。
+type AgentTracer struct {
+	NopObserver
+	sim     *Simulation
+	writer  *bufio.Writer
+	encoder *json.Encoder // ndjson
+	csv     *csv.Writer   // csv
+	format  string
+	every   int
+	counts  map[int]*AgentTrace // エージェントの ID ごとの、前回の記録からの回数
+	started bool                // CSV のヘッダーを書いたか
+	err     error
+}
+
+// sim の Simulation.AddObserver に登録して使う
+func MakeAgentTracer(sim *Simulation, w io.Writer, format string, every int) (*AgentTracer, error) {
+	if format != TraceCSV && format != TraceNDJSON {
+		return nil, &TraceFormatError{format}
+	}
+
+	writer := bufio.NewWriter(w)
+	return &AgentTracer{
+		sim:     sim,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+		csv:     csv.NewWriter(writer),
+		format:  format,
+		every:   max(1, every),
+		counts:  make(map[int]*AgentTrace),
+		started: false,
+		err:     nil,
+	}, nil
+}
+
+func (t *AgentTracer) count(id int) *AgentTrace {
+	if _, ok := t.counts[id]; !ok {
+		t.counts[id] = &AgentTrace{}
+	}
+	return t.counts[id]
+}
+
+func (t *AgentTracer) OnSongCreated(song *Song) {
+	t.count(song.creator_id).SongsCreated++
+}
+
+func (t *AgentTracer) OnSongEvaluated(listener *Agent, event *Event, song *Song, evaluation float64) {
+	t.count(listener.id).EvaluationsMade++
+}
+
+func (t *AgentTracer) OnEventOpened(organizer *Agent, event *Event) {
+	t.count(organizer.id).EventsOrganized++
+}
+
+func (t *AgentTracer) OnAgentDied(agent *Agent) {
+	delete(t.counts, agent.id)
+}
+
+func (t *AgentTracer) OnIterationEnd(summery *PublicSummery) {
+	// 一度失敗したら書き込まない
+	if t.err != nil || summery.Iteration%t.every != 0 {
+		return
+	}
+
+	for _, agent := range t.sim.agents {
+		// 生きているエージェントのみ
+		if agent.energy <= 0 {
+			continue
+		}
+
+		trace := AgentTrace{
+			Iteration:      summery.Iteration,
+			ID:             agent.id,
+			Role:           agent.role,
+			Energy:         agent.energy,
+			Gene:           agent.ToGene(),
+			CreatorMemory:  agent.creator.memory.Len(),
+			ListenerMemory: agent.listener.memory.Len(),
+		}
+		if counts, ok := t.counts[agent.id]; ok {
+			trace.SongsCreated = counts.SongsCreated
+			trace.EvaluationsMade = counts.EvaluationsMade
+			trace.EventsOrganized = counts.EventsOrganized
+		}
+
+		if t.err = t.write(&trace); t.err != nil {
+			return
+		}
+	}
+	clear(t.counts)
+
+	t.err = t.writer.Flush()
+}
+
+// CSV のヘッダー
+func (t *AgentTracer) header() []string {
+	header := []string{"iteration", "id", "role_creator", "role_listener", "role_organizer", "energy"}
+	for _, name := range GeneNames {
+		header = append(header, "gene_"+name)
+	}
+	return append(header, "creator_memory", "listener_memory", "songs_created", "evaluations_made", "events_organized")
+}
+
+func (t *AgentTracer) write(trace *AgentTrace) error {
+	if t.format == TraceNDJSON {
+		// Encode は末尾に改行を付ける
+		return t.encoder.Encode(trace)
+	}
+
+	if !t.started {
+		t.started = true
+		if err := t.csv.Write(t.header()); err != nil {
+			return err
+		}
+	}
+
+	row := []string{
+		strconv.Itoa(trace.Iteration),
+		strconv.Itoa(trace.ID),
+		strconv.FormatBool(trace.Role[0]),
+		strconv.FormatBool(trace.Role[1]),
+		strconv.FormatBool(trace.Role[2]),
+		strconv.FormatFloat(trace.Energy, 'g', -1, 64),
+	}
+	for _, gene := range trace.Gene {
+		row = append(row, strconv.FormatFloat(gene, 'g', -1, 64))
+	}
+	row = append(row,
+		strconv.Itoa(trace.CreatorMemory),
+		strconv.Itoa(trace.ListenerMemory),
+		strconv.Itoa(trace.SongsCreated),
+		strconv.Itoa(trace.EvaluationsMade),
+		strconv.Itoa(trace.EventsOrganized),
+	)
+	if err := t.csv.Write(row); err != nil {
+		return err
+	}
+	t.csv.Flush()
+	return t.csv.Error()
+}
+
+// チェックポイントから再開したシミュレーションの続きを書くために、中断前に書かれた記録 r のうち
+// チェックポイントのイテレーションまでの行を書き直す。通知を受ける前に呼ぶ。
+// 記録の間隔がチェックポイントをまたぐ場合、再開後の最初の行の回数は再開してからのものになる。
+func (t *AgentTracer) Resume(r io.Reader) error {
+	if t.format == TraceNDJSON {
+		decoder := json.NewDecoder(r)
+		for {
+			var trace AgentTrace
+			if err := decoder.Decode(&trace); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			if trace.Iteration <= t.sim.iteration {
+				if err := t.encoder.Encode(&trace); err != nil {
+					return err
+				}
+			}
+		}
+		return t.writer.Flush()
+	}
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil // 空のファイルなら、最初から書く
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(header, t.header()) {
+		return errors.New("agent trace has a different header")
+	}
+	if err := t.csv.Write(header); err != nil {
+		return err
+	}
+	t.started = true
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		iteration, err := strconv.Atoi(row[0])
+		if err != nil {
+			return err
+		}
+		if iteration <= t.sim.iteration {
+			if err := t.csv.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	t.csv.Flush()
+	if err := t.csv.Error(); err != nil {
+		return err
+	}
+	return t.writer.Flush()
+}
+
+// それまでに起きたエラーがあれば返す
+func (t *AgentTracer) Err() error {
+	return t.err
+}
+
+type TraceFormatError struct {
+	format string
+}
+
+func (e *TraceFormatError) Error() string {
+	return "Unknown trace format: " + strconv.Quote(e.format)
+}
@@ -0,0 +1,62 @@
+package MuSL
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 途中のチェックポイントから再開して Resume した記録は、中断しなかった場合と同じになる
+func TestAgentTracerResume(t *testing.T) {
+	for _, format := range []string{TraceCSV, TraceNDJSON} {
+		reset_id_counters()
+		sim, err := test_config(ScheduleFixed, 5).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.SetVerbose(false)
+
+		var full bytes.Buffer
+		tracer, err := MakeAgentTracer(sim, &full, format, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim.AddObserver(tracer)
+
+		var checkpoint bytes.Buffer
+		if _, err := sim.Advance(12); err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.SaveCheckpoint(&checkpoint); err != nil {
+			t.Fatal(err)
+		}
+		if err := sim.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		// 別のプロセスで再開する
+		reset_id_counters()
+		resumed, err := LoadCheckpoint(&checkpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed.SetVerbose(false)
+
+		// 中断前の記録には、チェックポイントより後の行も含まれている
+		var rewritten bytes.Buffer
+		resumed_tracer, err := MakeAgentTracer(resumed, &rewritten, format, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resumed_tracer.Resume(bytes.NewReader(full.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		resumed.AddObserver(resumed_tracer)
+		if err := resumed.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		if rewritten.String() != full.String() {
+			t.Errorf("%s: resumed trace differs from the uninterrupted one", format)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"MuSL/MuSL"
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// シミュレーションの出力と実行のしかたの引数 (run と resume で共通)
+type output_flags struct {
+	output_file      string
+	format           string
+	phylogeny_file   string
+	catalog_file     string
+	stream_file      string
+	stream_flush     int
+	checkpoint_file  string
+	checkpoint_every int
+	trace_file       string
+	trace_every      int
+	trace_format     string
+	event_file       string
+	serve            string
+	console          bool
+}
+
+func addOutputFlags(fs *flag.FlagSet) *output_flags {
+	o := &output_flags{}
+	fs.StringVar(&o.output_file, "output_file", "output.json", "Output file name, empty to skip (default: output.json)")
+	fs.StringVar(&o.format, "format", "", "Output format: json or csv, empty to choose by the extension of -output_file (default: \"\")")
+	fs.StringVar(&o.phylogeny_file, "phylogeny_file", "", "Output file name of the song phylogeny (default: none)")
+	fs.StringVar(&o.catalog_file, "catalog_file", "", "Output file name of the song catalog (default: none)")
+	fs.StringVar(&o.stream_file, "stream_file", "", "Output file name of the per-iteration summery stream in NDJSON (default: none)")
+	fs.IntVar(&o.stream_flush, "stream_flush", 1, "Flush the summery stream every this many iterations (default: 1)")
+	fs.StringVar(&o.checkpoint_file, "checkpoint_file", "checkpoint.gob.gz", "Checkpoint file name (default: checkpoint.gob.gz)")
+	fs.IntVar(&o.checkpoint_every, "checkpoint_every", 0, "Save a checkpoint every this many iterations, 0 to disable (default: 0)")
+	fs.StringVar(&o.trace_file, "trace_file", "", "Output file name of the per-agent state trace (default: none)")
+	fs.IntVar(&o.trace_every, "trace_every", 1, "Write the per-agent state trace every this many iterations (default: 1)")
+	fs.StringVar(&o.trace_format, "trace_format", "", "Trace format: csv or ndjson, empty to choose by the extension of -trace_file (default: \"\")")
+	fs.StringVar(&o.event_file, "event_file", "", "Output file name of the per-event log in NDJSON (default: none)")
+	fs.StringVar(&o.serve, "serve", "", "Serve a live dashboard over HTTP on this address, e.g. :8080 (default: none)")
+	fs.BoolVar(&o.console, "console", false, "Step through the simulation with an interactive console on stdin instead of running it to the end (default: false)")
+	return o
+}
+
+// 1 つのシミュレーションを実行して出力する
+func runCommand(fs *flag.FlagSet, args []string) error {
+	config_args := addConfigFlags(fs)
+	outputs := addOutputFlags(fs)
+	config, err := parseConfig(fs, config_args, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+	if outputs.format, err = summeryFormat(outputs.output_file, outputs.format); err != nil {
+		return err
+	}
+
+	// シミュレーションのパラメータ (エージェントの既定値は SimulationConfig.Build を参照)
+	sim, err := config.Build()
+	if err != nil {
+		return &CommandError{"Invalid parameters", err}
+	}
+
+	// シード値を表示する (ランダムに決めた場合も再現できるように)
+	println("Seed:", config.Seed)
+
+	return simulate(sim, outputs, false)
+}
+
+// チェックポイントから再開して出力する (シミュレーションのパラメータはチェックポイントのものを使う)
+func resumeCommand(fs *flag.FlagSet, args []string) error {
+	outputs := addOutputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	var err error
+	if outputs.format, err = summeryFormat(outputs.output_file, outputs.format); err != nil {
+		return err
+	}
+
+	sim, err := MuSL.LoadCheckpointFile(fs.Arg(0))
+	if err != nil {
+		return &CommandError{"Error loading checkpoint", err}
+	}
+	println("Resume from iteration:", sim.Iteration())
+
+	return simulate(sim, outputs, true)
+}
+
+// シミュレーションを実行し、o の指定どおりに出力する
+func simulate(sim *MuSL.Simulation, o *output_flags, resumed bool) error {
+	sim.SetCheckpoint(o.checkpoint_file, o.checkpoint_every)
+
+	// イテレーションごとにサマリーを書き出す
+	var stream *MuSL.StreamWriter
+	if o.stream_file != "" {
+		file, err := openStream(o.stream_file, resumed, sim.Iteration())
+		if err != nil {
+			return &CommandError{"Error creating stream file", err}
+		}
+		defer file.Close()
+
+		stream = MuSL.MakeStreamWriter(file, o.stream_flush)
+		sim.AddObserver(stream)
+
+		// まとめて書き出さないなら、サマリーを保持しない
+		if o.output_file == "" {
+			sim.SetRetainSummery(false)
+		}
+	}
+
+	// エージェントごとの状態を書き出す
+	var tracer *MuSL.AgentTracer
+	if o.trace_file != "" {
+		trace_format := o.trace_format
+		if trace_format == "" {
+			trace_format = MuSL.TraceNDJSON
+			if strings.EqualFold(filepath.Ext(o.trace_file), ".csv") {
+				trace_format = MuSL.TraceCSV
+			}
+		}
+
+		// 再開する場合は、チェックポイントより後の (中断前に書かれた) 行を除いて続きから書く
+		previous, err := readResumed(o.trace_file, resumed)
+		if err != nil {
+			return &CommandError{"Error reading trace file", err}
+		}
+		file, err := os.Create(o.trace_file)
+		if err != nil {
+			return &CommandError{"Error creating trace file", err}
+		}
+		defer file.Close()
+
+		tracer, err = MuSL.MakeAgentTracer(sim, file, trace_format, o.trace_every)
+		if err != nil {
+			return &CommandError{"Invalid trace format", err}
+		}
+		if previous != nil {
+			if err := tracer.Resume(bytes.NewReader(previous)); err != nil {
+				return &CommandError{"Error rewriting trace file", err}
+			}
+		}
+		sim.AddObserver(tracer)
+	}
+
+	// 精算されたイベントを書き出す
+	var event_logger *MuSL.EventLogger
+	if o.event_file != "" {
+		previous, err := readResumed(o.event_file, resumed)
+		if err != nil {
+			return &CommandError{"Error reading event file", err}
+		}
+		file, err := os.Create(o.event_file)
+		if err != nil {
+			return &CommandError{"Error creating event file", err}
+		}
+		defer file.Close()
+
+		event_logger = MuSL.MakeEventLogger(sim, file)
+		if previous != nil {
+			if err := event_logger.Resume(bytes.NewReader(previous)); err != nil {
+				return &CommandError{"Error rewriting event file", err}
+			}
+		}
+		sim.AddObserver(event_logger)
+	}
+
+	// 途中経過をダッシュボードで見せる
+	var dashboard *MuSL.Dashboard
+	var serve_errors chan error
+	if o.serve != "" {
+		listener, err := net.Listen("tcp", o.serve)
+		if err != nil {
+			return &CommandError{"Error starting dashboard", err}
+		}
+
+		dashboard = MuSL.MakeDashboard()
+		dashboard.Load(sim.GetSummery()) // 再開した場合はそれまでの分も見せる
+		sim.AddObserver(dashboard)
+
+		serve_errors = make(chan error, 1)
+		go func() {
+			serve_errors <- http.Serve(listener, dashboard)
+		}()
+		fmt.Println("Dashboard: http://" + listener.Addr().String() + "/")
+	}
+
+	if o.console {
+		// 対話モードでは進み具合をコンソールが表示する
+		sim.SetVerbose(false)
+		if err := MuSL.MakeConsole(sim, os.Stdin, os.Stdout).Run(); err != nil {
+			return &CommandError{"Error running console", err}
+		}
+	} else if err := sim.Run(); err != nil {
+		return &CommandError{"Error saving checkpoint", err}
+	}
+	if dashboard != nil {
+		dashboard.Finish()
+	}
+
+	if stream != nil {
+		if err := stream.Flush(); err != nil {
+			return &CommandError{"Error writing summery stream", err}
+		}
+	}
+
+	if tracer != nil {
+		if err := tracer.Err(); err != nil {
+			return &CommandError{"Error writing agent trace", err}
+		}
+	}
+
+	if event_logger != nil {
+		if err := event_logger.Close(); err != nil {
+			return &CommandError{"Error writing event log", err}
+		}
+	}
+
+	summery := sim.GetSummery() // []*PublicSummery
+
+	// サマリーを書き込み
+	if o.output_file != "" {
+		if err := writeSummery(o.output_file, o.format, summery); err != nil {
+			return &CommandError{"Error writing summery", err}
+		}
+	}
+
+	// 楽曲の系統樹を json で書き込み
+	if o.phylogeny_file != "" {
+		if err := writeJSON(o.phylogeny_file, sim.GetPhylogeny()); err != nil {
+			return &CommandError{"Error writing phylogeny", err}
+		}
+	}
+
+	// 楽曲カタログを json で書き込み
+	if o.catalog_file != "" {
+		if err := writeJSON(o.catalog_file, sim.GetSongCatalog()); err != nil {
+			return &CommandError{"Error writing song catalog", err}
+		}
+	}
+
+	// 終わった後も、止められるまでダッシュボードを見せる
+	if dashboard != nil {
+		fmt.Println("Simulation finished; serving the dashboard until interrupted")
+		return &CommandError{"Error serving dashboard", <-serve_errors}
+	}
+	return nil
+}
+
+// サマリーのストリームを書き出すファイルを開く
+// 再開する場合は、チェックポイントより後の (中断前に書かれた) 行を除いて続きから書く
+func openStream(file_name string, resume bool, iteration int) (*os.File, error) {
+	if !resume {
+		return os.Create(file_name)
+	}
+
+	summery, err := readSummeryFile(file_name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.Create(file_name)
+	if err != nil {
+		return nil, err
+	}
+	stream := MuSL.MakeStreamWriter(file, len(summery))
+	for _, s := range summery {
+		if s.Iteration <= iteration {
+			stream.OnIterationEnd(s)
+		}
+	}
+	if err := stream.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// 再開する場合は、中断前に書かれたファイルの内容を返す (再開しない場合とファイルがない場合は nil)
+func readResumed(file_name string, resume bool) ([]byte, error) {
+	if !resume {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file_name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
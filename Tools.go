@@ -0,0 +1,140 @@
+package main
+
+import (
+	"MuSL/MuSL"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// サマリーのグラフを SVG で書き出す
+func plotCommand(fs *flag.FlagSet, args []string) error {
+	var plot_dir string
+	var plot_iteration int
+	fs.StringVar(&plot_dir, "dir", "plots", "Output directory (default: plots)")
+	fs.IntVar(&plot_iteration, "iteration", -1, "Iteration of the genre scatter plot, negative for the last snapshot (default: -1)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	summery, err := readSummeryFile(fs.Arg(0))
+	if err != nil {
+		return &CommandError{"Error reading summery", err}
+	}
+	files, err := MuSL.PlotSummeries(plot_dir, summery, plot_iteration)
+	for _, file := range files {
+		fmt.Println("Wrote", file)
+	}
+	if err != nil {
+		return &CommandError{"Error plotting summery", err}
+	}
+	return nil
+}
+
+// ジャンル空間のアニメーションを書き出す
+func animateCommand(fs *flag.FlagSet, args []string) error {
+	var animation_file string
+	var animation_every int
+	var animation_point_size int
+	var animation_color string
+	var animation_highlight bool
+	var animation_delay int
+	fs.StringVar(&animation_file, "output_file", "genres.gif", "Output file name (default: genres.gif)")
+	fs.IntVar(&animation_every, "every", 1, "Draw a frame every this many iterations (default: 1)")
+	fs.IntVar(&animation_point_size, "point_size", 2, "Radius of a song in pixels (default: 2)")
+	fs.StringVar(&animation_color, "color", MuSL.AnimationLineage, "Color songs by lineage or age (default: lineage)")
+	fs.BoolVar(&animation_highlight, "highlight", true, "Circle the songs created in each frame's iteration (default: true)")
+	fs.IntVar(&animation_delay, "delay", 10, "Delay between frames in 1/100 seconds (default: 10)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	params, err := MuSL.MakeAnimationParams(animation_every, animation_point_size, animation_color, animation_highlight, animation_delay)
+	if err != nil {
+		return &CommandError{"Invalid animation parameters", err}
+	}
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return &CommandError{"Error reading phylogeny", err}
+	}
+	roots, err := MuSL.ReadPhylogeny(file)
+	file.Close()
+	if err != nil {
+		return &CommandError{"Error reading phylogeny", err}
+	}
+	if err := writeFile(animation_file, func(file *os.File) error {
+		return MuSL.WriteGenreAnimation(file, roots, params)
+	}); err != nil {
+		return &CommandError{"Error writing animation", err}
+	}
+	return nil
+}
+
+// 圧縮されたジャンルのスナップショットを展開する
+func expandGenresCommand(fs *flag.FlagSet, args []string) error {
+	var output_file string
+	var format string
+	fs.StringVar(&output_file, "output_file", "output.json", "Output file name (default: output.json)")
+	fs.StringVar(&format, "format", "", "Output format: json or csv, empty to choose by the extension of -output_file (default: \"\")")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	format, err := summeryFormat(output_file, format)
+	if err != nil {
+		return err
+	}
+
+	summery, err := readSummeryFile(fs.Arg(0))
+	if err == nil {
+		err = MuSL.ExpandGenres(summery)
+	}
+	if err == nil {
+		err = writeSummery(output_file, format, summery)
+	}
+	if err != nil {
+		return &CommandError{"Error expanding genres", err}
+	}
+	return nil
+}
+
+// 設定を確かめ、-config と引数をまとめた設定を JSON で表示する
+func validateConfigCommand(fs *flag.FlagSet, args []string) error {
+	config, err := parseConfig(fs, addConfigFlags(fs), args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+	if err := config.Validate(); err != nil {
+		return &CommandError{"Invalid config", err}
+	}
+
+	json, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(json))
+	return nil
+}
+
+// シミュレーションを HTTP API で操作する
+func apiCommand(fs *flag.FlagSet, args []string) error {
+	var addr string
+	fs.StringVar(&addr, "addr", ":8081", "Address to listen on (default: :8081)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errUsage
+	}
+
+	fmt.Println("API: http://" + addr + "/simulations")
+	if err := http.ListenAndServe(addr, MuSL.MakeSimulationServer()); err != nil {
+		return &CommandError{"Error serving API", err}
+	}
+	return nil
+}